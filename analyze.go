@@ -0,0 +1,942 @@
+package regex
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity is the risk level of an Issue found by Analyze
+type Severity int
+
+const (
+	// SeverityNone means no risk of catastrophic backtracking was found
+	SeverityNone Severity = iota
+
+	// SeverityMedium means the regex can take polynomial time (ie: n^2) on some inputs
+	SeverityMedium
+
+	// SeverityHigh means the regex can take exponential time on some inputs
+	SeverityHigh
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityNone:
+		return "none"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	}
+	return "unknown"
+}
+
+// Issue is a part of a regex that is vulnerable to catastrophic backtracking
+type Issue struct {
+	// Kind is the type of issue ("nested quantifier", "overlapping alternation" or "adjacent quantifiers")
+	Kind string
+
+	// Severity is the risk level of the issue
+	Severity Severity
+
+	// Complexity is the worst case time complexity of the issue ("exponential" or "polynomial")
+	Complexity string
+
+	// Expr is the sub-expression with the issue, from the expanded pattern
+	Expr string
+
+	// Offset is the byte offset of the sub-expression in the original pattern
+	Offset int
+}
+
+// Report is the result of Analyze
+type Report struct {
+	// Pattern is the original pattern
+	Pattern string
+
+	// Expanded is the pattern after it was expanded by the preprocessor
+	Expanded string
+
+	// Issues is the list of issues found in the pattern
+	Issues []Issue
+
+	// Severity is the highest severity of all the issues
+	Severity Severity
+
+	// Err is set if the pattern could not be parsed
+	Err error
+}
+
+// Safe returns true if the pattern was parsed, and no issues were found
+func (r Report) Safe() bool {
+	return r.Err == nil && len(r.Issues) == 0
+}
+
+// Analyze looks for parts of a regex that are vulnerable to catastrophic backtracking (ReDoS),
+// without compiling or running it
+//
+// the pattern goes through the same preprocessing as Comp, with the same params.
+//
+// this is a static check, so it can miss some issues, and flag some patterns that are safe in practice.
+// atomic groups and possessive quantifiers are treated as safe, because they do not backtrack.
+// note: the RE2 engine (used with the nopcre tag) runs in linear time, so these issues only matter with pcre
+func Analyze(re string, params ...string) Report {
+	expanded, err := compRENamed(re, params, nil)
+	report := Report{Pattern: re, Expanded: expanded, Issues: []Issue{}}
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	p := reParser{re: expanded}
+	root, err := p.parse()
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	a := reAnalyzer{re: expanded}
+	a.walk(root, false)
+
+	var srcMap []int
+	if len(a.issues) != 0 {
+		srcMap = compREMap(re, params, nil)
+	}
+
+	for _, issue := range a.issues {
+		if issue.Offset < len(srcMap) {
+			issue.Offset = srcMap[issue.Offset]
+		}
+		report.Issues = append(report.Issues, issue)
+		if issue.Severity > report.Severity {
+			report.Severity = issue.Severity
+		}
+	}
+
+	return report
+}
+
+//* regex parser
+
+type reNodeKind int
+
+const (
+	// reChar matches a single char from a charSet
+	reChar reNodeKind = iota
+
+	// reSeq matches each sub node in order
+	reSeq
+
+	// reAlt matches one of its sub nodes
+	reAlt
+
+	// reGroup matches its only sub node (including lookarounds, which do not consume any chars)
+	reGroup
+
+	// reRepeat matches its only sub node between min and max times (max is -1 for no limit)
+	reRepeat
+
+	// reEmpty does not consume any chars (anchors and other assertions)
+	reEmpty
+
+	// reRef is a backreference or recursion, which can match any string
+	reRef
+)
+
+// reNode is a node of a parsed regex
+type reNode struct {
+	kind reNodeKind
+	chars charSet
+	sub []*reNode
+	min, max int
+
+	// atomic is true for atomic groups and possessive quantifiers
+	atomic bool
+
+	// lookaround is true for lookahead and lookbehind groups
+	lookaround bool
+
+	start, end int
+}
+
+// charSet is the set of chars a node can match
+//
+// the first 128 bits are ascii chars, and bit 128 stands for every non-ascii char
+type charSet [3]uint64
+
+const charSetNonASCII = 128
+
+// add adds a char to the set (a negative char is not valid, and is ignored)
+func (c *charSet) add(b int) {
+	if b < 0 {
+		return
+	}
+	c[b/64] |= 1 << (b % 64)
+}
+
+func (c *charSet) addRange(from rune, to rune) {
+	if from < 0 || to < 0 {
+		return
+	}
+	for r := from; r <= to && r < 128; r++ {
+		c.add(int(r))
+	}
+	if to >= 128 {
+		c.add(charSetNonASCII)
+	}
+}
+
+func (c charSet) union(o charSet) charSet {
+	return charSet{c[0] | o[0], c[1] | o[1], c[2] | o[2]}
+}
+
+func (c charSet) overlaps(o charSet) bool {
+	return c[0]&o[0] != 0 || c[1]&o[1] != 0 || c[2]&o[2] != 0
+}
+
+func (c charSet) subsetOf(o charSet) bool {
+	return c[0]&^o[0] == 0 && c[1]&^o[1] == 0 && c[2]&^o[2] == 0
+}
+
+func (c charSet) negate() charSet {
+	return charSet{^c[0], ^c[1], ^c[2] & 1}
+}
+
+// fold adds the other case of each ascii letter
+func (c charSet) fold() charSet {
+	for r := 'a'; r <= 'z'; r++ {
+		lower, upper := charSet{}, charSet{}
+		lower.add(int(r))
+		upper.add(int(r - 'a' + 'A'))
+		if c.overlaps(lower) || c.overlaps(upper) {
+			c = c.union(lower).union(upper)
+		}
+	}
+	return c
+}
+
+// charSetOf returns the charSet of a class escape like \d, or false if @c is not a class escape
+func charSetOf(c byte) (charSet, bool) {
+	set := charSet{}
+	switch c {
+	case 'd', 'D':
+		set.addRange('0', '9')
+	case 'w', 'W':
+		set.addRange('0', '9')
+		set.addRange('a', 'z')
+		set.addRange('A', 'Z')
+		set.add('_')
+	case 's', 'S':
+		set.addRange('\t', '\r')
+		set.add(' ')
+	case 'h', 'H':
+		set.add('\t')
+		set.add(' ')
+		set.add(charSetNonASCII)
+	case 'v', 'V', 'R':
+		set.addRange('\n', '\r')
+		set.add(charSetNonASCII)
+		if c == 'R' {
+			return set, true
+		}
+	case 'N':
+		set.add('\n')
+		return set.negate(), true
+	case 'p', 'P', 'X', 'C':
+		// unicode properties are not checked, so they match everything
+		return charSet{}.negate(), true
+	default:
+		return set, false
+	}
+
+	// \D, \W, \S, \H and \V are the opposite of their lowercase version
+	if c >= 'A' && c <= 'Z' {
+		set = set.negate()
+	}
+	return set, true
+}
+
+// ErrAnalyzeParse is the error returned in a Report when Analyze could not parse a pattern
+var ErrAnalyzeParse error = errors.New("regex: failed to parse pattern")
+
+// reParser is a simple pcre parser, that only keeps the parts of a regex needed by Analyze
+type reParser struct {
+	re string
+	i int
+	caseless bool
+}
+
+func (p *reParser) fail(msg string) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrAnalyzeParse, msg, p.i)
+}
+
+func (p *reParser) parse() (*reNode, error) {
+	node, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.re) {
+		return nil, p.fail("unmatched )")
+	}
+	return node, nil
+}
+
+// parseAlt parses a list of alternatives, up to the end of the group
+func (p *reParser) parseAlt() (*reNode, error) {
+	start := p.i
+	alt := &reNode{kind: reAlt}
+
+	for {
+		seq, err := p.parseSeq()
+		if err != nil {
+			return nil, err
+		}
+		alt.sub = append(alt.sub, seq)
+
+		if p.i < len(p.re) && p.re[p.i] == '|' {
+			p.i++
+			continue
+		}
+		break
+	}
+
+	if len(alt.sub) == 1 {
+		return alt.sub[0], nil
+	}
+
+	alt.start, alt.end = start, p.i
+	return alt, nil
+}
+
+// parseSeq parses a list of nodes, up to the next | or the end of the group
+func (p *reParser) parseSeq() (*reNode, error) {
+	seq := &reNode{kind: reSeq, start: p.i}
+
+	for p.i < len(p.re) && p.re[p.i] != '|' && p.re[p.i] != ')' {
+		atom, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if atom == nil {
+			continue
+		}
+
+		atom = p.parseRepeat(atom)
+		seq.sub = append(seq.sub, atom)
+	}
+
+	seq.end = p.i
+	return seq, nil
+}
+
+// parseRepeat parses a quantifier after a node, if there is one
+func (p *reParser) parseRepeat(atom *reNode) *reNode {
+	if p.i >= len(p.re) {
+		return atom
+	}
+
+	min, max := 0, 0
+	switch p.re[p.i] {
+	case '*':
+		min, max = 0, -1
+		p.i++
+	case '+':
+		min, max = 1, -1
+		p.i++
+	case '?':
+		min, max = 0, 1
+		p.i++
+	case '{':
+		end := strings.IndexByte(p.re[p.i:], '}')
+		if end == -1 {
+			return atom
+		}
+		parts := strings.SplitN(p.re[p.i+1:p.i+end], ",", 2)
+		n, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return atom
+		}
+		min, max = n, n
+		if len(parts) == 2 {
+			if parts[1] == "" {
+				max = -1
+			}else if max, err = strconv.Atoi(parts[1]); err != nil {
+				return atom
+			}
+		}
+		p.i += end+1
+	default:
+		return atom
+	}
+
+	rep := &reNode{kind: reRepeat, sub: []*reNode{atom}, min: min, max: max, start: atom.start}
+	if p.i < len(p.re) && p.re[p.i] == '?' {
+		p.i++
+	}else if p.i < len(p.re) && p.re[p.i] == '+' {
+		rep.atomic = true
+		p.i++
+	}
+	rep.end = p.i
+
+	return rep
+}
+
+// parseAtom parses a single char, class, escape or group
+//
+// nil is returned for things that do not match anything, like comments
+func (p *reParser) parseAtom() (*reNode, error) {
+	start := p.i
+	c := p.re[p.i]
+
+	switch c {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.parseClass()
+	case '\\':
+		return p.parseEscape()
+	case '^', '$':
+		p.i++
+		return &reNode{kind: reEmpty, start: start, end: p.i}, nil
+	case '.':
+		p.i++
+		set := charSet{}
+		set.add('\n')
+		return &reNode{kind: reChar, chars: set.negate(), start: start, end: p.i}, nil
+	case '*', '+', '?':
+		return nil, p.fail("nothing to repeat")
+	}
+
+	r, size := utf8.DecodeRuneInString(p.re[p.i:])
+	p.i += size
+	return p.char(r, start), nil
+}
+
+// char returns a node that matches a single char
+func (p *reParser) char(r rune, start int) *reNode {
+	set := charSet{}
+	set.addRange(r, r)
+	if p.caseless {
+		set = set.fold()
+	}
+	return &reNode{kind: reChar, chars: set, start: start, end: p.i}
+}
+
+func (p *reParser) parseGroup() (*reNode, error) {
+	start := p.i
+	p.i++
+
+	group := &reNode{kind: reGroup, start: start}
+	caseless := p.caseless
+
+	if strings.HasPrefix(p.re[p.i:], "*") {
+		// backtracking verbs like (*SKIP) do not match anything
+		end := strings.IndexByte(p.re[p.i:], ')')
+		if end == -1 {
+			return nil, p.fail("missing )")
+		}
+		p.i += end+1
+		return nil, nil
+	}
+
+	if strings.HasPrefix(p.re[p.i:], "?") {
+		p.i++
+		rest := p.re[p.i:]
+
+		switch {
+		case strings.HasPrefix(rest, "#"):
+			end := strings.IndexByte(rest, ')')
+			if end == -1 {
+				return nil, p.fail("missing ) after comment")
+			}
+			p.i += end+1
+			return nil, nil
+		case strings.HasPrefix(rest, ":"), strings.HasPrefix(rest, "|"):
+			p.i++
+		case strings.HasPrefix(rest, ">"):
+			group.atomic = true
+			p.i++
+		case strings.HasPrefix(rest, "="), strings.HasPrefix(rest, "!"):
+			group.lookaround = true
+			p.i++
+		case strings.HasPrefix(rest, "<="), strings.HasPrefix(rest, "<!"):
+			group.lookaround = true
+			p.i += 2
+		case strings.HasPrefix(rest, "<"), strings.HasPrefix(rest, "P<"), strings.HasPrefix(rest, "'"):
+			end := strings.IndexAny(rest[1:], ">'")
+			if end == -1 {
+				return nil, p.fail("missing end of group name")
+			}
+			p.i += end+2
+		case strings.HasPrefix(rest, "("):
+			// conditional group: skip the condition
+			end := strings.IndexByte(rest, ')')
+			if end == -1 {
+				return nil, p.fail("missing ) after condition")
+			}
+			p.i += end+1
+		case strings.HasPrefix(rest, "R"), strings.HasPrefix(rest, "&"), strings.HasPrefix(rest, "P>"), strings.HasPrefix(rest, "P="),
+			len(rest) != 0 && (rest[0] == '+' || rest[0] == '-') && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9',
+			len(rest) != 0 && rest[0] >= '0' && rest[0] <= '9':
+			// recursion or named backreference
+			end := strings.IndexByte(rest, ')')
+			if end == -1 {
+				return nil, p.fail("missing )")
+			}
+			p.i += end+1
+			return &reNode{kind: reRef, start: start, end: p.i}, nil
+		default:
+			// inline flags, like (?i) or (?i-m:re)
+			end := strings.IndexAny(rest, ":)")
+			if end == -1 {
+				return nil, p.fail("missing )")
+			}
+			flags := rest[:end]
+			on := true
+			for _, f := range flags {
+				if f == '-' {
+					on = false
+				}else if f == 'i' {
+					p.caseless = on
+				}
+			}
+			p.i += end+1
+			if rest[end] == ')' {
+				// the flags are kept until the end of the parent group
+				return nil, nil
+			}
+		}
+	}
+
+	sub, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if p.i >= len(p.re) || p.re[p.i] != ')' {
+		return nil, p.fail("missing )")
+	}
+	p.i++
+
+	p.caseless = caseless
+	group.sub = []*reNode{sub}
+	group.end = p.i
+	return group, nil
+}
+
+func (p *reParser) parseEscape() (*reNode, error) {
+	start := p.i
+	if p.i+1 >= len(p.re) {
+		return nil, p.fail("\\ at end of pattern")
+	}
+	c := p.re[p.i+1]
+	p.i += 2
+
+	switch c {
+	case 'b', 'B', 'A', 'z', 'Z', 'G', 'K':
+		return &reNode{kind: reEmpty, start: start, end: p.i}, nil
+	case 'Q':
+		// quoted literal, up to \E
+		end := strings.Index(p.re[p.i:], `\E`)
+		lit := p.re[p.i:]
+		if end != -1 {
+			lit = lit[:end]
+		}
+		seq := &reNode{kind: reSeq, start: start}
+		for _, r := range lit {
+			seq.sub = append(seq.sub, p.char(r, start))
+		}
+		p.i += len(lit)
+		if end != -1 {
+			p.i += 2
+		}
+		seq.end = p.i
+		return seq, nil
+	case 'E':
+		return nil, nil
+	case 'g', 'k':
+		p.skipBraces()
+		return &reNode{kind: reRef, start: start, end: p.i}, nil
+	case 'x', 'o':
+		if !p.skipBraces() {
+			for n := 0; n < 2 && p.i < len(p.re) && strings.IndexByte("0123456789abcdefABCDEF", p.re[p.i]) != -1; n++ {
+				p.i++
+			}
+		}
+		base := 16
+		if c == 'o' {
+			base = 8
+		}
+		n, err := strconv.ParseUint(strings.Trim(p.re[start+2:p.i], "{}"), base, 32)
+		if errors.Is(err, strconv.ErrRange) || n > utf8.MaxRune {
+			p.i = start
+			return nil, p.fail("character value in \\x{} or \\o{} is too large")
+		}
+		return p.char(rune(n), start), nil
+	case 'p', 'P':
+		if !p.skipBraces() && p.i < len(p.re) {
+			p.i++
+		}
+	case 'n':
+		return p.char('\n', start), nil
+	case 't':
+		return p.char('\t', start), nil
+	case 'r':
+		return p.char('\r', start), nil
+	case 'f':
+		return p.char('\f', start), nil
+	case 'c':
+		if p.i < len(p.re) {
+			p.i++
+		}
+		return &reNode{kind: reChar, chars: charSet{}.negate(), start: start, end: p.i}, nil
+	}
+
+	if c >= '1' && c <= '9' {
+		for p.i < len(p.re) && p.re[p.i] >= '0' && p.re[p.i] <= '9' {
+			p.i++
+		}
+		return &reNode{kind: reRef, start: start, end: p.i}, nil
+	}
+
+	if set, ok := charSetOf(c); ok {
+		return &reNode{kind: reChar, chars: set, start: start, end: p.i}, nil
+	}
+
+	r, size := utf8.DecodeRuneInString(p.re[start+1:])
+	p.i = start + 1 + size
+	return p.char(r, start), nil
+}
+
+// skipBraces skips a {...}, <...> or '...' after an escape, and returns false if there was none
+func (p *reParser) skipBraces() bool {
+	if p.i >= len(p.re) {
+		return false
+	}
+
+	close := map[byte]byte{'{': '}', '<': '>', '\'': '\''}[p.re[p.i]]
+	if close == 0 {
+		return false
+	}
+
+	end := strings.IndexByte(p.re[p.i+1:], close)
+	if end == -1 {
+		return false
+	}
+	p.i += end+2
+	return true
+}
+
+func (p *reParser) parseClass() (*reNode, error) {
+	start := p.i
+	p.i++
+
+	negate := false
+	if p.i < len(p.re) && p.re[p.i] == '^' {
+		negate = true
+		p.i++
+	}
+
+	set := charSet{}
+	first := true
+	for {
+		if p.i >= len(p.re) {
+			return nil, p.fail("missing terminating ] for character class")
+		}
+
+		c := p.re[p.i]
+		if c == ']' && !first {
+			p.i++
+			break
+		}
+		first = false
+
+		if c == '[' && strings.HasPrefix(p.re[p.i:], "[:") {
+			if end := strings.Index(p.re[p.i:], ":]"); end != -1 {
+				// posix classes are treated as every char
+				set = set.union(charSet{}.negate())
+				p.i += end+2
+				continue
+			}
+		}
+
+		var from rune
+		if c == '\\' && p.i+1 < len(p.re) {
+			if esc, ok := charSetOf(p.re[p.i+1]); ok {
+				set = set.union(esc)
+				p.i += 2
+				if p.re[p.i-1] == 'p' || p.re[p.i-1] == 'P' {
+					if !p.skipBraces() && p.i < len(p.re) {
+						p.i++
+					}
+				}
+				continue
+			}
+
+			node, err := p.parseEscape()
+			if err != nil {
+				return nil, err
+			}
+			if node != nil && node.kind == reChar {
+				set = set.union(node.chars)
+			}
+			continue
+		}else{
+			var size int
+			from, size = utf8.DecodeRuneInString(p.re[p.i:])
+			p.i += size
+		}
+
+		to := from
+		if p.i+1 < len(p.re) && p.re[p.i] == '-' && p.re[p.i+1] != ']' {
+			r, size := utf8.DecodeRuneInString(p.re[p.i+1:])
+			if r == '\\' {
+				r, size = utf8.DecodeRuneInString(p.re[p.i+2:])
+				size++
+			}
+			to = r
+			p.i += 1 + size
+		}
+		set.addRange(from, to)
+	}
+
+	if p.caseless {
+		set = set.fold()
+	}
+	if negate {
+		set = set.negate()
+	}
+
+	return &reNode{kind: reChar, chars: set, start: start, end: p.i}, nil
+}
+
+//* regex analyzer
+
+// reAnalyzer walks a parsed regex, and keeps a list of the issues it found
+type reAnalyzer struct {
+	re string
+	issues []Issue
+}
+
+func (a *reAnalyzer) add(kind string, severity Severity, node *reNode) {
+	complexity := "polynomial"
+	if severity == SeverityHigh {
+		complexity = "exponential"
+	}
+	a.issues = append(a.issues, Issue{Kind: kind, Severity: severity, Complexity: complexity, Expr: a.re[node.start:node.end], Offset: node.start})
+}
+
+// walk checks a node and all of its sub nodes
+//
+// @atomic: true if the node is inside an atomic group, which cannot backtrack
+func (a *reAnalyzer) walk(node *reNode, atomic bool) {
+	atomic = atomic || node.atomic
+
+	if !atomic {
+		switch node.kind {
+		case reRepeat:
+			if node.max == -1 {
+				if inner := nestedRepeat(node.sub[0]); inner != nil {
+					a.add("nested quantifier", SeverityHigh, node)
+				}else if overlappingAlt(node.sub[0]) {
+					a.add("overlapping alternation", SeverityHigh, node)
+				}
+			}
+		case reSeq:
+			a.checkAdjacent(node)
+		}
+	}
+
+	for _, sub := range node.sub {
+		a.walk(sub, atomic)
+	}
+}
+
+// checkAdjacent looks for unlimited quantifiers in a sequence that can match the same chars,
+// with nothing required between them to tell them apart (ie: \d+\d+ or .*=.*)
+func (a *reAnalyzer) checkAdjacent(seq *reNode) {
+	for i, node := range seq.sub {
+		if node.kind != reRepeat || node.max != -1 || node.atomic {
+			continue
+		}
+		chars := node.sub[0].letters()
+
+		for j := i+1; j < len(seq.sub); j++ {
+			next := seq.sub[j]
+			if next.kind == reRepeat && next.max == -1 && !next.atomic {
+				if chars.overlaps(next.sub[0].letters()) {
+					a.add("adjacent quantifiers", SeverityMedium, &reNode{start: node.start, end: next.end})
+				}
+				break
+			}
+
+			// anything between the quantifiers must be optional, or be matched by both of them
+			if !next.nullable() && !next.letters().subsetOf(chars) {
+				break
+			}
+		}
+	}
+}
+
+// nestedRepeat finds an unlimited quantifier inside the body of another unlimited quantifier,
+// which can split the same input between its iterations in many different ways (ie: (a+)+ or (\w+\s?)*)
+//
+// a quantifier is not returned if the body also needs a char that it can never match (ie: (a+b)+ is safe, but (a+.)+ is not)
+func nestedRepeat(node *reNode) *reNode {
+	if node.atomic {
+		return nil
+	}
+
+	switch node.kind {
+	case reGroup:
+		if node.lookaround {
+			return nil
+		}
+		return nestedRepeat(node.sub[0])
+	case reAlt:
+		for _, sub := range node.sub {
+			if res := nestedRepeat(sub); res != nil {
+				return res
+			}
+		}
+	case reRepeat:
+		if node.max == -1 {
+			return node
+		}
+		if node.max != 0 {
+			return nestedRepeat(node.sub[0])
+		}
+	case reSeq:
+		for i, sub := range node.sub {
+			inner := nestedRepeat(sub)
+			if inner == nil {
+				continue
+			}
+
+			chars := inner.sub[0].letters()
+			safe := false
+			for j, other := range node.sub {
+				if j != i && !other.nullable() && !other.letters().overlaps(chars) {
+					safe = true
+					break
+				}
+			}
+			if !safe {
+				return inner
+			}
+		}
+	}
+
+	return nil
+}
+
+// overlappingAlt returns true if a node is a list of alternatives, where more than one alternative can match the same first char
+func overlappingAlt(node *reNode) bool {
+	for node.kind == reGroup && !node.atomic && !node.lookaround {
+		node = node.sub[0]
+	}
+	if node.kind == reSeq && len(node.sub) == 1 {
+		return overlappingAlt(node.sub[0])
+	}
+	if node.kind != reAlt {
+		return false
+	}
+
+	for i := range node.sub {
+		for j := i+1; j < len(node.sub); j++ {
+			if node.sub[i].first().overlaps(node.sub[j].first()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nullable returns true if a node can match an empty string
+func (node *reNode) nullable() bool {
+	switch node.kind {
+	case reChar:
+		return false
+	case reSeq:
+		for _, sub := range node.sub {
+			if !sub.nullable() {
+				return false
+			}
+		}
+		return true
+	case reAlt:
+		for _, sub := range node.sub {
+			if sub.nullable() {
+				return true
+			}
+		}
+		return false
+	case reGroup:
+		return node.lookaround || node.sub[0].nullable()
+	case reRepeat:
+		return node.min == 0 || node.sub[0].nullable()
+	}
+	return true
+}
+
+// first returns the chars a node can start with
+func (node *reNode) first() charSet {
+	switch node.kind {
+	case reChar:
+		return node.chars
+	case reSeq:
+		set := charSet{}
+		for _, sub := range node.sub {
+			set = set.union(sub.first())
+			if !sub.nullable() {
+				break
+			}
+		}
+		return set
+	case reAlt:
+		set := charSet{}
+		for _, sub := range node.sub {
+			set = set.union(sub.first())
+		}
+		return set
+	case reGroup:
+		if node.lookaround {
+			return charSet{}
+		}
+		return node.sub[0].first()
+	case reRepeat:
+		if node.max == 0 {
+			return charSet{}
+		}
+		return node.sub[0].first()
+	case reRef:
+		return charSet{}.negate()
+	}
+	return charSet{}
+}
+
+// letters returns every char a node can match
+func (node *reNode) letters() charSet {
+	switch node.kind {
+	case reChar:
+		return node.chars
+	case reRef:
+		return charSet{}.negate()
+	case reGroup:
+		if node.lookaround {
+			return charSet{}
+		}
+	case reRepeat:
+		if node.max == 0 {
+			return charSet{}
+		}
+	}
+
+	set := charSet{}
+	for _, sub := range node.sub {
+		set = set.union(sub.letters())
+	}
+	return set
+}
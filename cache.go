@@ -0,0 +1,207 @@
+package regex
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/AspieSoft/go-regex/v8/common"
+)
+
+// Cache is used by Comp and CompTry to store compiled regex
+//
+// each key can store either a compiled regex, or the error returned when it failed to compile.
+// a custom Cache can be set with the SetCache method.
+//
+// if a Cache also has a DelOld(time.Duration) method, it will be called to remove old items when the system is low on memory
+type Cache interface {
+	// Get returns the compiled regex or error stored for a key,
+	// or a nil *Regexp and a nil error if the key is not in the cache
+	Get(key string) (*Regexp, error)
+
+	// Set stores either a compiled regex, or the error returned when it failed to compile
+	Set(key string, value *Regexp, err error)
+
+	// Delete removes a key from the cache
+	Delete(key string)
+
+	// Len returns the number of items in the cache
+	Len() int
+
+	// Purge removes every item from the cache
+	Purge()
+}
+
+// DefaultCacheEntries is the max number of compiled regex kept by the default cache
+const DefaultCacheEntries = 10000
+
+// DefaultCacheBytes is the max estimated size of the compiled regex kept by the default cache
+const DefaultCacheBytes = 64 * 1024 * 1024
+
+var cacheMU sync.RWMutex
+var cache Cache = NewLRUCache(DefaultCacheEntries, DefaultCacheBytes)
+var compCache *common.LRU[[]byte] = common.NewLRU(DefaultCacheEntries, DefaultCacheBytes, func(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+})
+
+// NewLRUCache returns a Cache that removes the least recently used regex once it holds too many entries, or too many bytes
+//
+// @maxEntries: the max number of compiled regex to keep (0 for no limit)
+//
+// @maxBytes: the max estimated size of the compiled regex in bytes (0 for no limit)
+func NewLRUCache(maxEntries int, maxBytes int64) Cache {
+	return common.NewLRU(maxEntries, maxBytes, func(key string, value *Regexp) int64 {
+		return value.size(key)
+	})
+}
+
+// SetCache changes the Cache used by Comp and CompTry
+//
+// the new cache starts out empty.
+// if @c is nil, a new default LRU cache will be used
+func SetCache(c Cache) {
+	if c == nil {
+		c = NewLRUCache(DefaultCacheEntries, DefaultCacheBytes)
+	}
+
+	cacheMU.Lock()
+	cache = c
+	cacheMU.Unlock()
+}
+
+// getCache returns the Cache used by Comp and CompTry
+func getCache() Cache {
+	cacheMU.RLock()
+	defer cacheMU.RUnlock()
+	return cache
+}
+
+// size returns the estimated memory used by a compiled regex in bytes
+//
+// pcre does not expose the size of a compiled pattern, so this is estimated from the length of the pattern
+func (reg *Regexp) size(key string) int64 {
+	if reg == nil {
+		return int64(len(key))
+	}
+
+	size := int64(len(key)) + reg.len*8 + 256
+	for _, name := range reg.names {
+		size += int64(len(name)) + 16
+	}
+	return size
+}
+
+
+//* cache stats
+
+// CacheCounters holds the stats of a cache
+type CacheCounters struct {
+	// Hits is the number of lookups that found a value
+	Hits uint64
+	// NegativeHits is the number of lookups that found a cached error
+	NegativeHits uint64
+	// Misses is the number of lookups that found nothing
+	Misses uint64
+	// Evictions is the number of items removed for being over the limits of the cache, or for being too old (items removed with Delete are not counted)
+	Evictions uint64
+	// Entries is the number of items in the cache
+	Entries int
+	// Bytes is the estimated size of the items in the cache
+	Bytes int64
+}
+
+// CacheStats holds the stats of the compiled regex cache, and the compRE preprocessing cache
+type CacheStats struct {
+	Comp CacheCounters
+	CompRE CacheCounters
+}
+
+// CacheEntry describes an item in a cache
+type CacheEntry = common.CacheEntry
+
+// CacheSnapshotList holds a list of the items in the compiled regex cache, and the compRE preprocessing cache
+type CacheSnapshotList struct {
+	Comp []CacheEntry
+	CompRE []CacheEntry
+}
+
+type cacheCounter struct {
+	hits uint64
+	negativeHits uint64
+	misses uint64
+}
+
+var compStats cacheCounter
+var compREStats cacheCounter
+
+// count records the result of a cache lookup
+func (c *cacheCounter) count(found bool, err error) {
+	if err != nil {
+		atomic.AddUint64(&c.negativeHits, 1)
+	}else if found {
+		atomic.AddUint64(&c.hits, 1)
+	}else{
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+func (c *cacheCounter) counters() CacheCounters {
+	return CacheCounters{
+		Hits: atomic.LoadUint64(&c.hits),
+		NegativeHits: atomic.LoadUint64(&c.negativeHits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+func (c *cacheCounter) reset() {
+	atomic.StoreUint64(&c.hits, 0)
+	atomic.StoreUint64(&c.negativeHits, 0)
+	atomic.StoreUint64(&c.misses, 0)
+}
+
+// GetCacheStats returns the hit, miss and eviction counters of the compiled regex cache, and the compRE preprocessing cache
+//
+// a custom Cache can report its evictions and size by adding an Evictions() uint64 method, and a Bytes() int64 method
+func GetCacheStats() CacheStats {
+	c := getCache()
+
+	stats := CacheStats{
+		Comp: compStats.counters(),
+		CompRE: compREStats.counters(),
+	}
+
+	stats.Comp.Entries = c.Len()
+	if e, ok := c.(interface{ Evictions() uint64 }); ok {
+		stats.Comp.Evictions = e.Evictions()
+	}
+	if b, ok := c.(interface{ Bytes() int64 }); ok {
+		stats.Comp.Bytes = b.Bytes()
+	}
+
+	stats.CompRE.Entries = compCache.Len()
+	stats.CompRE.Evictions = compCache.Evictions()
+	stats.CompRE.Bytes = compCache.Bytes()
+
+	return stats
+}
+
+// ResetCacheStats sets the hit and miss counters back to 0
+func ResetCacheStats() {
+	compStats.reset()
+	compREStats.reset()
+}
+
+// CacheSnapshot returns a list of the keys in the compiled regex cache, and the compRE preprocessing cache,
+// with their last use time and estimated size
+//
+// a custom Cache can add a Snapshot() []CacheEntry method to be included
+func CacheSnapshot() CacheSnapshotList {
+	res := CacheSnapshotList{
+		CompRE: compCache.Snapshot(),
+	}
+
+	if s, ok := getCache().(interface{ Snapshot() []CacheEntry }); ok {
+		res.Comp = s.Snapshot()
+	}
+
+	return res
+}
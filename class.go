@@ -0,0 +1,286 @@
+package regex
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// bgPart is a single part of a [...] class
+type bgPart struct {
+	// kind is the sort order of the part (see the bgKind constants)
+	kind int
+
+	// ref is the char the part is sorted by
+	ref rune
+
+	b []byte
+}
+
+const (
+	bgKindRange = iota
+	bgKindChar
+
+	// an unescaped [ is kept after the other chars, so it cannot be read as the start of a posix class (like [:)
+	bgKindBracket
+
+	// an unescaped - is kept at the end, so it cannot turn the parts around it into a range
+	bgKindHyphen
+)
+
+// regPosixClass matches a posix class (like [:alpha:] or [:^space:]) at the start of a string
+var regPosixClass *regexp.Regexp = regexp.MustCompile(`^\[:\^?[A-Za-z]+:\]`)
+
+// findClasses returns the start and end of each [...] class in a regex
+//
+// escaped brackets (\[) and quoted text (\Q...\E) are skipped, and a class that is never closed is not included
+func findClasses(re []byte) [][]int {
+	res := [][]int{}
+	for i := 0; i < len(re); i++ {
+		if re[i] == '\\' {
+			if i+1 < len(re) && re[i+1] == 'Q' {
+				i += quoteLen(re[i:])-1
+			}else{
+				i++
+			}
+		}else if re[i] == '[' {
+			end := classEnd(re, i)
+			if end == -1 {
+				break
+			}
+			res = append(res, []int{i, end})
+			i = end-1
+		}
+	}
+	return res
+}
+
+// classEnd returns the index after the closing bracket of a [...] class that starts at @i, or -1 if it is never closed
+//
+// a ] at the start of the class (like []a] or [^]a]) is a literal char,
+// posix classes (like [:alpha:]) are skipped as a single part,
+// and the nested classes of set operations (like [a-z--[aeiou]]) are included
+func classEnd(re []byte, i int) int {
+	j := i+1
+	if j < len(re) && re[j] == '^' {
+		j++
+	}
+	if j < len(re) && re[j] == ']' {
+		j++
+	}
+
+	for j < len(re) {
+		if re[j] == ']' {
+			return j+1
+		}
+
+		// the nested class of a set operation (like [a-z--[aeiou]])
+		if isSetOp(re[j:]) {
+			j = classEnd(re, j+2)
+			if j == -1 {
+				return -1
+			}
+			continue
+		}
+
+		size, _ := classPartLen(re[j:])
+		j += size
+	}
+
+	return -1
+}
+
+// sortClass sorts the parts of a [...] class, without changing which chars it matches
+//
+// @b: the content of the class, without the brackets and ^
+//
+// ranges (a-z) and escape sequences (\x{e9}) are kept together, and utf8 chars are never split.
+// only classes of single chars and ranges are sorted, anything else is left byte for byte the same
+func sortClass(b []byte) []byte {
+	// the value of a param is not known yet, and could change the meaning of the chars around it (like a - at the end),
+	// so a class with params (like %{1:class}) is left unchanged
+	if regCompParam.Match(b) {
+		return b
+	}
+
+	// a ] at the start of the class is a literal char, which would close the class anywhere else
+	if len(b) != 0 && b[0] == ']' {
+		return b
+	}
+
+	parts := []bgPart{}
+	for i := 0; i < len(b); {
+		// set operations that expandClassSet could not expand are a compile error, so the class is left as it is
+		if isSetOp(b[i:]) {
+			return b
+		}
+
+		size, isRange := classPartLen(b[i:])
+
+		// classes with sets of chars (like \d, \p{L} or [:alpha:]) are left unchanged
+		if isClassEscape(b[i:i+size]) {
+			return b
+		}
+
+		ref := classAtomRef(b[i:i+size])
+
+		kind := bgKindChar
+		if isRange {
+			kind = bgKindRange
+		}else if size == 1 && b[i] == '-' {
+			kind = bgKindHyphen
+		}else if size == 1 && b[i] == '[' {
+			kind = bgKindBracket
+		}
+
+		parts = append(parts, bgPart{kind: kind, ref: ref, b: b[i:i+size]})
+		i += size
+	}
+
+	sort.SliceStable(parts, func(i, j int) bool {
+		if parts[i].kind != parts[j].kind {
+			return parts[i].kind < parts[j].kind
+		}
+		return parts[i].ref < parts[j].ref
+	})
+
+	res := make([]byte, 0, len(b)+1)
+	for i, part := range parts {
+		if part.kind == bgKindHyphen && i != 0 && parts[i-1].kind == bgKindHyphen {
+			// a second - would make a range with the first one
+			continue
+		}
+
+		// a ^ at the start of the class would negate it
+		if i == 0 && part.b[0] == '^' {
+			res = append(res, '\\')
+		}
+		res = append(res, part.b...)
+	}
+	return res
+}
+
+// classPartLen returns the length of the range (a-z), escape sequence, posix class, or utf8 char at the start of @b
+//
+// a char followed by - and another char is read as a range,
+// even if the engine would read the - as a literal (like a-\d), so the parts of the range are never moved apart
+func classPartLen(b []byte) (int, bool) {
+	size := classAtomLen(b)
+	if size+1 < len(b) && b[size] == '-' && b[size+1] != ']' && !isClassEscape(b[:size]) && !isSetOp(b[size:]) {
+		// the end of a range is always a single char, so a-[:digit:] is read as a-[ followed by :digit:
+		return size+1+classCharLen(b[size+1:]), true
+	}
+	return size, false
+}
+
+// classAtomLen returns the length of the escape sequence, posix class, or utf8 char at the start of @b
+func classAtomLen(b []byte) int {
+	if loc := regPosixClass.FindIndex(b); loc != nil {
+		return loc[1]
+	}
+	return classCharLen(b)
+}
+
+// classCharLen returns the length of the escape sequence or utf8 char at the start of @b
+func classCharLen(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+
+	if b[0] != '\\' || len(b) == 1 {
+		_, size := utf8.DecodeRune(b)
+		return size
+	}
+
+	switch b[1] {
+	case 'Q':
+		return quoteLen(b)
+	case 'x', 'o', 'p', 'P', 'N':
+		// \x{...}, \o{...}, \p{...}, \P{...}, \N{U+...}
+		if len(b) > 2 && b[2] == '{' {
+			for i := 3; i < len(b); i++ {
+				if b[i] == '}' {
+					return i+1
+				}
+			}
+			return len(b)
+		}
+
+		if b[1] == 'x' {
+			i := 2
+			for i < len(b) && i < 4 && isHexByte(b[i]) {
+				i++
+			}
+			return i
+		}else if b[1] == 'p' || b[1] == 'P' {
+			// \pL
+			if len(b) > 2 {
+				return 3
+			}
+		}
+	case 'c':
+		// \cX
+		if len(b) > 2 {
+			_, size := utf8.DecodeRune(b[2:])
+			return 2+size
+		}
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		// octal
+		i := 2
+		for i < len(b) && i < 4 && b[i] >= '0' && b[i] <= '7' {
+			i++
+		}
+		return i
+	}
+
+	_, size := utf8.DecodeRune(b[1:])
+	return 1+size
+}
+
+// classAtomRef returns the char an escape sequence or utf8 char is sorted by
+//
+// escape sequences are sorted by the char after the \
+func classAtomRef(b []byte) rune {
+	if len(b) > 1 && b[0] == '\\' {
+		b = b[1:]
+	}
+	r, _ := utf8.DecodeRune(b)
+	return r
+}
+
+// isClassEscape returns true if an escape sequence or posix class matches a set of chars (like \d, \p{L} or [:alpha:]),
+// so it cannot be the start of a range
+//
+// quoted text (\Q...\E) is also included, since it can hold more than one char
+func isClassEscape(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+
+	if b[0] == '[' {
+		return b[1] == ':'
+	}else if b[0] != '\\' {
+		return false
+	}
+
+	switch b[1] {
+	case 'd', 'D', 'w', 'W', 's', 'S', 'p', 'P', 'H', 'V', 'N', 'R', 'X', 'Q':
+		return true
+	}
+	return false
+}
+
+// quoteLen returns the length of the quoted text (\Q...\E) at the start of @b
+//
+// if there is no \E, the text is quoted to the end of the regex
+func quoteLen(b []byte) int {
+	if end := bytes.Index(b[2:], []byte(`\E`)); end != -1 {
+		return end+4
+	}
+	return len(b)
+}
+
+func isHexByte(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
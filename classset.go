@@ -0,0 +1,574 @@
+package regex
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// runeSet is a sorted list of char ranges, that do not overlap or touch
+//
+// surrogates (U+D800 to U+DFFF) are never included, since they are not valid in a utf8 pattern
+type runeSet [][2]rune
+
+// runeSetAll holds every valid char
+var runeSetAll = runeSet{{0, 0xD7FF}, {0xE000, unicode.MaxRune}}
+
+// runeSetOf makes a runeSet from a list of ranges, that can be out of order, overlap or touch
+func runeSetOf(list ...[2]rune) runeSet {
+	list = append([][2]rune{}, list...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i][0] < list[j][0]
+	})
+
+	res := runeSet{}
+	for _, r := range list {
+		if r[0] > r[1] {
+			continue
+		}
+
+		if n := len(res); n != 0 && r[0] <= res[n-1][1]+1 {
+			if r[1] > res[n-1][1] {
+				res[n-1][1] = r[1]
+			}
+			continue
+		}
+		res = append(res, r)
+	}
+
+	return res.intersect(runeSetAll)
+}
+
+// runeSetChars makes a runeSet from a list of chars
+func runeSetChars(chars ...rune) runeSet {
+	list := make([][2]rune, len(chars))
+	for i, c := range chars {
+		list[i] = [2]rune{c, c}
+	}
+	return runeSetOf(list...)
+}
+
+// runeSetTable makes a runeSet from a unicode.RangeTable
+func runeSetTable(table *unicode.RangeTable) runeSet {
+	list := [][2]rune{}
+	for _, r := range table.R16 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			if r.Stride == 1 {
+				list = append(list, [2]rune{c, rune(r.Hi)})
+				break
+			}
+			list = append(list, [2]rune{c, c})
+		}
+	}
+	for _, r := range table.R32 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			if r.Stride == 1 {
+				list = append(list, [2]rune{c, rune(r.Hi)})
+				break
+			}
+			list = append(list, [2]rune{c, c})
+		}
+	}
+	return runeSetOf(list...)
+}
+
+func (s runeSet) union(o runeSet) runeSet {
+	return runeSetOf(append(append([][2]rune{}, s...), o...)...)
+}
+
+func (s runeSet) intersect(o runeSet) runeSet {
+	res := runeSet{}
+	i, j := 0, 0
+	for i < len(s) && j < len(o) {
+		lo, hi := s[i][0], s[i][1]
+		if o[j][0] > lo {
+			lo = o[j][0]
+		}
+		if o[j][1] < hi {
+			hi = o[j][1]
+		}
+		if lo <= hi {
+			res = append(res, [2]rune{lo, hi})
+		}
+
+		if s[i][1] < o[j][1] {
+			i++
+		}else{
+			j++
+		}
+	}
+	return res
+}
+
+func (s runeSet) negate() runeSet {
+	res := runeSet{}
+	next := rune(0)
+	for _, r := range s {
+		if r[0] > next {
+			res = append(res, [2]rune{next, r[0]-1})
+		}
+		next = r[1]+1
+	}
+	if next <= unicode.MaxRune {
+		res = append(res, [2]rune{next, unicode.MaxRune})
+	}
+	return res.intersect(runeSetAll)
+}
+
+func (s runeSet) subtract(o runeSet) runeSet {
+	return s.intersect(o.negate())
+}
+
+// class returns the set as the content of a [...] class
+func (s runeSet) class() []byte {
+	res := []byte{}
+	for _, r := range s {
+		res = append(res, classRune(r[0])...)
+		if r[1] == r[0]+1 {
+			res = append(res, classRune(r[1])...)
+		}else if r[1] != r[0] {
+			res = append(res, '-')
+			res = append(res, classRune(r[1])...)
+		}
+	}
+	return res
+}
+
+// classRune formats a char for use inside a [...] class
+//
+// letters and digits are kept as they are, and anything else is written as \x{...}
+func classRune(c rune) []byte {
+	if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' {
+		return []byte{byte(c)}
+	}
+	return []byte(`\x{` + strconv.FormatInt(int64(c), 16) + `}`)
+}
+
+//* class set operations
+
+// isSetOp returns true if @b starts with a set operation (--, && or ||) followed by a nested class
+//
+// a posix class (like [:digit:]) is not a nested class, so the chars before it are left as they are
+func isSetOp(b []byte) bool {
+	return len(b) > 2 && b[2] == '[' && ((b[0] == '-' && b[1] == '-') || (b[0] == '&' && b[1] == '&') || (b[0] == '|' && b[1] == '|')) && !regPosixClass.Match(b[2:])
+}
+
+// hasSetOp returns true if the [...] class @b has a set operation that is not inside a nested class
+func hasSetOp(b []byte) bool {
+	for i := 1; i < len(b)-1; {
+		if isSetOp(b[i:]) {
+			return true
+		}
+		size, _ := classPartLen(b[i:])
+		i += size
+	}
+	return false
+}
+
+// expandClassSet expands a [...] class with set operations into a plain class
+//
+// subtraction [a-z--[aeiou]], intersection [\w&&[^\d]] and union [a-c||[x-z]] are supported,
+// and are run from left to right.
+// the right side of each operation must be a nested class
+//
+// false is returned if the class has no set operations, or it has a part that cannot be expanded
+// (like a param, or an unknown escape sequence).
+// a class with set operations that cannot be expanded is a compile error (see ErrClassSet)
+//
+// with pcre, the chars of \d, \w, \s, \p{...} and posix classes depend on the UCP option and the unicode tables of pcre,
+// so a class that uses them is written with lookarounds instead (see classSetExpr)
+func expandClassSet(b []byte) ([]byte, bool) {
+	// the value of a param is not known yet
+	if regCompParam.Match(b) {
+		return nil, false
+	}
+
+	p := classSetParser{b: b}
+	set, negate, ok := p.class()
+	if !ok && EngineName == "pcre" {
+		return classSetExpr(b)
+	}
+	if !ok || p.ops == 0 || p.i != len(b) {
+		return nil, false
+	}
+
+	if len(set) == 0 {
+		// an empty class cannot be written, so this uses a class that never matches (or always matches if negated)
+		if negate {
+			return []byte(`[\x{0}-\x{10ffff}]`), true
+		}
+		return []byte(`[^\x{0}-\x{10ffff}]`), true
+	}
+
+	res := []byte{'['}
+	if negate {
+		res = append(res, '^')
+	}
+	res = append(res, set.class()...)
+	return append(res, ']'), true
+}
+
+// classSetParser reads a [...] class with set operations into a runeSet
+type classSetParser struct {
+	b []byte
+	i int
+
+	// ops is the number of set operations that were found
+	ops int
+}
+
+// class reads a [...] class that starts at the current index
+//
+// the negate result is only used for the outer class, nested classes are negated before they are returned
+func (p *classSetParser) class() (runeSet, bool, bool) {
+	p.i++
+
+	negate := false
+	if p.i < len(p.b) && p.b[p.i] == '^' {
+		negate = true
+		p.i++
+	}
+
+	set := runeSet{}
+	start := p.i
+	for p.i < len(p.b) {
+		if p.b[p.i] == ']' && p.i != start {
+			p.i++
+			return set, negate, true
+		}
+
+		if isSetOp(p.b[p.i:]) {
+			op := p.b[p.i]
+			p.i += 2
+			p.ops++
+
+			sub, subNegate, ok := p.class()
+			if !ok {
+				return nil, false, false
+			}
+			if subNegate {
+				sub = sub.negate()
+			}
+
+			if op == '-' {
+				set = set.subtract(sub)
+			}else if op == '&' {
+				set = set.intersect(sub)
+			}else{
+				set = set.union(sub)
+			}
+
+			// only another set operation, or the end of the class, can follow a nested class,
+			// since the chars after it would be unclear (they could be part of either side)
+			if p.i < len(p.b) && p.b[p.i] != ']' && !isSetOp(p.b[p.i:]) {
+				return nil, false, false
+			}
+			continue
+		}
+
+		size, isRange := classPartLen(p.b[p.i:])
+		part := p.b[p.i:p.i+size]
+		p.i += size
+
+		if isRange {
+			loSize := classAtomLen(part)
+			lo, ok := classRuneValue(part[:loSize])
+			if !ok {
+				return nil, false, false
+			}
+			hi, ok := classRuneValue(part[loSize+1:])
+			if !ok || hi < lo {
+				return nil, false, false
+			}
+			set = set.union(runeSetOf([2]rune{lo, hi}))
+			continue
+		}
+
+		sub, ok := classAtomSet(part)
+		if !ok {
+			return nil, false, false
+		}
+		set = set.union(sub)
+	}
+
+	return nil, false, false
+}
+
+// classSetExpr writes a [...] class with set operations as a group that matches a single char, using lookarounds
+//
+//	[\w--[_]]   (?:(?![_])[\w])
+//	[\w&&[^\d]] (?:(?=[^\d])[\w])
+//	[\d||[a-f]] (?:[\d]|[a-f])
+//
+// the regex engine decides which chars each side matches, so the result is the same with any options
+func classSetExpr(b []byte) ([]byte, bool) {
+	p := classSetParser{b: b}
+	res, ok := p.expr()
+	if !ok || p.ops == 0 || p.i != len(b) {
+		return nil, false
+	}
+	return res, true
+}
+
+// expr reads a [...] class that starts at the current index into a regex that matches a single char (see classSetExpr)
+func (p *classSetParser) expr() ([]byte, bool) {
+	classStart := p.i
+	p.i++
+
+	negate := false
+	if p.i < len(p.b) && p.b[p.i] == '^' {
+		negate = true
+		p.i++
+	}
+
+	// res is the result of the set operations so far, or nil until the first one
+	var res []byte
+	start := p.i
+	for p.i < len(p.b) {
+		if p.b[p.i] == ']' && p.i != start {
+			p.i++
+			if res == nil {
+				// a class without set operations is kept as it is
+				return p.b[classStart:p.i], true
+			}
+			if negate {
+				return append(append([]byte(`(?:(?!`), res...), `)(?s:.))`...), true
+			}
+			return res, true
+		}
+
+		if isSetOp(p.b[p.i:]) {
+			op := p.b[p.i]
+
+			left := res
+			if left == nil {
+				left = append(append([]byte{'['}, p.b[start:p.i]...), ']')
+				if p.i == start {
+					// an empty class never matches
+					left = []byte(`(?!)`)
+				}
+			}
+
+			p.i += 2
+			p.ops++
+
+			right, ok := p.expr()
+			if !ok {
+				return nil, false
+			}
+
+			if op == '-' {
+				res = append(append(append(append([]byte(`(?:(?!`), right...), ')'), left...), ')')
+			}else if op == '&' {
+				res = append(append(append(append([]byte(`(?:(?=`), right...), ')'), left...), ')')
+			}else{
+				res = append(append(append(append([]byte(`(?:`), left...), '|'), right...), ')')
+			}
+
+			// only another set operation, or the end of the class, can follow a nested class
+			if p.i < len(p.b) && p.b[p.i] != ']' && !isSetOp(p.b[p.i:]) {
+				return nil, false
+			}
+			continue
+		}
+
+		size, _ := classPartLen(p.b[p.i:])
+		p.i += size
+	}
+
+	return nil, false
+}
+
+// classRuneValue returns the char of an escape sequence or utf8 char, for use in a range
+func classRuneValue(atom []byte) (rune, bool) {
+	set, ok := classAtomSet(atom)
+	if !ok || len(set) != 1 || set[0][0] != set[0][1] {
+		return 0, false
+	}
+	return set[0][0], true
+}
+
+// classAtomSet returns the chars matched by a single part of a class (an escape sequence, posix class, or utf8 char)
+//
+// \d, \w, \s and posix classes only match ascii chars, and \p{...} uses the unicode tables of go, in the same way as RE2.
+// pcre can change these with the UCP option, so they are not expanded for pcre
+func classAtomSet(atom []byte) (runeSet, bool) {
+	if len(atom) == 0 {
+		return nil, false
+	}
+
+	if loc := regPosixClass.FindIndex(atom); loc != nil && loc[1] == len(atom) {
+		if EngineName == "pcre" {
+			return nil, false
+		}
+
+		name := string(atom[2:len(atom)-2])
+		negate := name[0] == '^'
+		if negate {
+			name = name[1:]
+		}
+
+		set, ok := posixClasses[name]
+		if !ok {
+			return nil, false
+		}
+		if negate {
+			return set.negate(), true
+		}
+		return set, true
+	}
+
+	if atom[0] != '\\' || len(atom) == 1 {
+		r, size := utf8.DecodeRune(atom)
+		if r == utf8.RuneError && size <= 1 {
+			return nil, false
+		}
+		return runeSetChars(r), true
+	}
+
+	c := atom[1]
+	switch c {
+	case 'd', 'D', 'w', 'W', 's', 'S':
+		if EngineName == "pcre" {
+			return nil, false
+		}
+
+		set := map[byte]runeSet{'d': posixClasses["digit"], 'w': posixClasses["word"], 's': spaceChars}[c|0x20]
+		if c < 'a' {
+			return set.negate(), true
+		}
+		return set, true
+	case 'h', 'H', 'v', 'V':
+		if EngineName != "pcre" {
+			if c == 'v' {
+				return runeSetChars('\v'), true
+			}
+			return nil, false
+		}
+
+		set := runeSetChars('\t', ' ', 0xA0, 0x1680, 0x180E, 0x202F, 0x205F, 0x3000).union(runeSetOf([2]rune{0x2000, 0x200A}))
+		if c|0x20 == 'v' {
+			set = runeSetChars(0x85, 0x2028, 0x2029).union(runeSetOf([2]rune{'\n', '\r'}))
+		}
+		if c < 'a' {
+			return set.negate(), true
+		}
+		return set, true
+	case 'p', 'P':
+		if EngineName == "pcre" {
+			return nil, false
+		}
+
+		name := string(atom[2:])
+		if len(name) > 2 && name[0] == '{' {
+			name = name[1:len(name)-1]
+		}
+
+		negate := c == 'P'
+		if len(name) != 0 && name[0] == '^' {
+			negate = !negate
+			name = name[1:]
+		}
+
+		set, ok := unicodeClass(name)
+		if !ok {
+			return nil, false
+		}
+		if negate {
+			return set.negate(), true
+		}
+		return set, true
+	case 'x', 'o':
+		base := 16
+		if c == 'o' {
+			base = 8
+		}
+
+		digits := atom[2:]
+		if len(digits) != 0 && digits[0] == '{' {
+			digits = bytes.Trim(digits, "{}")
+		}else if c == 'o' {
+			return nil, false
+		}
+		if len(digits) == 0 {
+			return runeSetChars(0), true
+		}
+
+		n, err := strconv.ParseInt(string(digits), base, 32)
+		if err != nil {
+			return nil, false
+		}
+		return runeSetChars(rune(n)), true
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n, err := strconv.ParseInt(string(atom[1:]), 8, 32)
+		if err != nil {
+			return nil, false
+		}
+		return runeSetChars(rune(n)), true
+	case 'c':
+		if len(atom) != 3 {
+			return nil, false
+		}
+		return runeSetChars(rune(unicode.ToUpper(rune(atom[2])) ^ 0x40)), true
+	case 'Q':
+		// quoted text is a list of chars
+		text := bytes.TrimSuffix(atom[2:], []byte(`\E`))
+		set := runeSet{}
+		for _, r := range string(text) {
+			set = set.union(runeSetChars(r))
+		}
+		return set, true
+	}
+
+	if r, ok := map[byte]rune{'n': '\n', 't': '\t', 'r': '\r', 'f': '\f', 'a': '\a', 'e': 0x1B, 'b': '\b'}[c]; ok {
+		return runeSetChars(r), true
+	}
+
+	r, _ := utf8.DecodeRune(atom[1:])
+	if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		// unknown escape sequences are left for the regex engine to report
+		return nil, false
+	}
+	return runeSetChars(r), true
+}
+
+// unicodeClass returns the chars of a unicode property (like L, Lu or Greek)
+func unicodeClass(name string) (runeSet, bool) {
+	switch name {
+	case "Any":
+		return runeSetAll, true
+	case "L&":
+		return runeSetTable(unicode.Lu).union(runeSetTable(unicode.Ll)).union(runeSetTable(unicode.Lt)), true
+	}
+
+	if table, ok := unicode.Categories[name]; ok {
+		return runeSetTable(table), true
+	}
+	if table, ok := unicode.Scripts[name]; ok {
+		return runeSetTable(table), true
+	}
+	return nil, false
+}
+
+// spaceChars are the chars matched by \s in RE2
+var spaceChars = runeSetChars('\t', '\n', '\f', '\r', ' ')
+
+// posixClasses are the chars matched by each posix class (like [:alpha:]), which only include ascii chars
+var posixClasses = map[string]runeSet{
+	"alnum": runeSetOf([2]rune{'0', '9'}, [2]rune{'A', 'Z'}, [2]rune{'a', 'z'}),
+	"alpha": runeSetOf([2]rune{'A', 'Z'}, [2]rune{'a', 'z'}),
+	"ascii": runeSetOf([2]rune{0, 0x7F}),
+	"blank": runeSetChars('\t', ' '),
+	"cntrl": runeSetOf([2]rune{0, 0x1F}, [2]rune{0x7F, 0x7F}),
+	"digit": runeSetOf([2]rune{'0', '9'}),
+	"graph": runeSetOf([2]rune{'!', '~'}),
+	"lower": runeSetOf([2]rune{'a', 'z'}),
+	"print": runeSetOf([2]rune{' ', '~'}),
+	"punct": runeSetOf([2]rune{'!', '/'}, [2]rune{':', '@'}, [2]rune{'[', '`'}, [2]rune{'{', '~'}),
+	"space": runeSetOf([2]rune{'\t', '\r'}, [2]rune{' ', ' '}),
+	"upper": runeSetOf([2]rune{'A', 'Z'}),
+	"word": runeSetOf([2]rune{'0', '9'}, [2]rune{'A', 'Z'}, [2]rune{'a', 'z'}, [2]rune{'_', '_'}),
+	"xdigit": runeSetOf([2]rune{'0', '9'}, [2]rune{'A', 'F'}, [2]rune{'a', 'f'}),
+}
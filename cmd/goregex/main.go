@@ -0,0 +1,351 @@
+// goregex runs the go-regex module from the command line
+//
+// usage:
+//
+//	goregex match [flags] <pattern> [file...]
+//	goregex find [flags] <pattern> [file...]
+//	goregex replace [flags] <pattern> <replacement> [file...]
+//	goregex split [flags] <pattern> [file...]
+//	goregex escape <string...>
+//	goregex valid [flags] <pattern...>
+//
+// the input is read from stdin when no files are given, and each file is matched separately.
+// patterns use the same extended syntax as regex.Comp (%1 params, \' for `, and (?#comments))
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/AspieSoft/go-regex/v8"
+)
+
+const usage = `usage: goregex <command> [flags] [args]
+
+commands:
+  match <pattern> [file...]                  exit with 0 if the input matches, or 1 if it does not
+  find <pattern> [file...]                   print each match on its own line
+  replace <pattern> <replacement> [file...]  replace matches ($1, ${name}) and print the result
+  split <pattern> [file...]                  split the input, and print each part on its own line
+  escape <string...>                         escape a string for use in a pattern
+  valid <pattern...>                         exit with 0 if every pattern is valid, or 1 if not
+
+the input is read from stdin when no files are given, and each file is matched separately
+
+run "goregex <command> -h" for the flags of a command
+`
+
+// exitNoMatch is the exit code used when nothing matched, or a pattern is not valid
+const exitNoMatch = 1
+
+// exitError is the exit code used for bad arguments, and errors reading or writing files
+const exitError = 2
+
+// paramList is a flag that can be set more than once
+type paramList []string
+
+func (p *paramList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *paramList) Set(val string) error {
+	*p = append(*p, val)
+	return nil
+}
+
+// command holds the flags shared by the commands that compile a pattern
+type command struct {
+	flags *flag.FlagSet
+	params paramList
+	opts regex.Options
+}
+
+func newCommand(name string, args string) *command {
+	cmd := command{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+
+	cmd.flags.Usage = func() {
+		fmt.Fprintf(cmd.flags.Output(), "usage: goregex %s [flags] %s\n\nflags:\n", name, args)
+		cmd.flags.PrintDefaults()
+	}
+
+	cmd.flags.Var(&cmd.params, "p", "a param for the pattern, used by %1, %2, ... (can be set more than once)")
+	cmd.flags.BoolVar(&cmd.opts.CaseInsensitive, "icase", false, "match without case sensitivity")
+	cmd.flags.BoolVar(&cmd.opts.Multiline, "multiline", false, "^ and $ match at the start and end of each line")
+	cmd.flags.BoolVar(&cmd.opts.DotAll, "dotall", false, ". also matches newlines")
+
+	return &cmd
+}
+
+// parse parses the flags, and returns the args that are left
+//
+// @min: the min number of args
+func (cmd *command) parse(args []string, min int) ([]string, error) {
+	if err := cmd.flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if cmd.flags.NArg() < min {
+		cmd.flags.Usage()
+		return nil, flag.ErrHelp
+	}
+
+	return cmd.flags.Args(), nil
+}
+
+// comp compiles a pattern with the params and options of the command
+func (cmd *command) comp(re string) (*regex.Regexp, error) {
+	return regex.CompOptsTry(re, cmd.opts, cmd.params...)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs a command, and returns the exit code
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	var code int
+	var err error
+
+	switch args[0] {
+	case "match":
+		code, err = runMatch(args[1:], stdin, stderr)
+	case "find":
+		code, err = runFind(args[1:], stdin, out, stderr)
+	case "replace":
+		code, err = runReplace(args[1:], stdin, out, stderr)
+	case "split":
+		code, err = runSplit(args[1:], stdin, out, stderr)
+	case "escape":
+		for _, arg := range args[1:] {
+			fmt.Fprintln(out, regex.Escape(arg))
+		}
+	case "valid":
+		code, err = runValid(args[1:], stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+	default:
+		fmt.Fprintf(stderr, "goregex: unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, "goregex:", err)
+		}
+		return exitError
+	}
+
+	return code
+}
+
+// eachInput reads each file, or stdin if there are no files, and runs @fn on its content
+//
+// each file is read separately, so a match cannot start in one file and end in the next
+//
+// @fn: returns false to skip the files that are left
+func eachInput(files []string, stdin io.Reader, fn func(input []byte) bool) error {
+	if len(files) == 0 {
+		input, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		fn(input)
+		return nil
+	}
+
+	for _, name := range files {
+		input, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if !fn(input) {
+			break
+		}
+	}
+	return nil
+}
+
+func runMatch(args []string, stdin io.Reader, stderr io.Writer) (int, error) {
+	cmd := newCommand("match", "<pattern> [file...]")
+	cmd.flags.SetOutput(stderr)
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	reg, err := cmd.comp(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	found := false
+	err = eachInput(args[1:], stdin, func(input []byte) bool {
+		found = reg.Match(input)
+		return !found
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return exitNoMatch, nil
+	}
+	return 0, nil
+}
+
+func runFind(args []string, stdin io.Reader, out io.Writer, stderr io.Writer) (int, error) {
+	cmd := newCommand("find", "<pattern> [file...]")
+	cmd.flags.SetOutput(stderr)
+	n := cmd.flags.Int("n", -1, "the max number of matches to print (-1 for no limit)")
+	group := cmd.flags.Int("g", 0, "print a capture group in place of the full match")
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	reg, err := cmd.comp(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if groups := len(reg.SubexpNames())-1; *group < 0 || *group > groups {
+		return 0, fmt.Errorf("find -g %d: the pattern has %d capture groups", *group, groups)
+	}
+
+	found := false
+	count := 0
+	err = eachInput(args[1:], stdin, func(input []byte) bool {
+		reg.AllSubmatchesFunc(input, func(ind []int, match [][]byte) bool {
+			if *n >= 0 && count >= *n {
+				return false
+			}
+			count++
+			found = true
+
+			if *group < len(match) {
+				out.Write(match[*group])
+			}
+			out.Write([]byte{'\n'})
+			return true
+		})
+		return *n < 0 || count < *n
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return exitNoMatch, nil
+	}
+	return 0, nil
+}
+
+func runReplace(args []string, stdin io.Reader, out io.Writer, stderr io.Writer) (int, error) {
+	cmd := newCommand("replace", "<pattern> <replacement> [file...]")
+	cmd.flags.SetOutput(stderr)
+	inPlace := cmd.flags.Bool("i", false, "replace the matches in each file, in place of printing the result")
+	maxSize := cmd.flags.Int64("max", 0, "the max length of a match in bytes, to keep memory bounded for large input (0 for no limit)")
+	args, err := cmd.parse(args, 2)
+	if err != nil {
+		return 0, err
+	}
+
+	reg, err := cmd.comp(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	rep := []byte(args[1])
+	files := args[2:]
+
+	if *inPlace {
+		if len(files) == 0 {
+			return 0, errors.New("replace -i needs at least one file")
+		}
+
+		for _, name := range files {
+			// io.EOF means the file had no matches, and was left unchanged
+			if err := reg.RepFileStr(name, rep, true, *maxSize); err != nil && err != io.EOF {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+
+	if len(files) == 0 {
+		return 0, reg.RepReader(stdin, out, rep, *maxSize)
+	}
+
+	// each file is replaced separately, so a match cannot start in one file and end in the next
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		err = reg.RepReader(file, out, rep, *maxSize)
+		file.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, nil
+}
+
+func runSplit(args []string, stdin io.Reader, out io.Writer, stderr io.Writer) (int, error) {
+	cmd := newCommand("split", "<pattern> [file...]")
+	cmd.flags.SetOutput(stderr)
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	reg, err := cmd.comp(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	err = eachInput(args[1:], stdin, func(input []byte) bool {
+		for _, part := range reg.Split(input) {
+			out.Write(part)
+			out.Write([]byte{'\n'})
+		}
+		return true
+	})
+	return 0, err
+}
+
+func runValid(args []string, stderr io.Writer) (int, error) {
+	cmd := newCommand("valid", "<pattern...>")
+	cmd.flags.SetOutput(stderr)
+	args, err := cmd.parse(args, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	code := 0
+	for _, re := range args {
+		if _, err := cmd.comp(re); err != nil {
+			if cerr, ok := err.(*regex.CompileError); ok {
+				fmt.Fprintln(stderr, cerr.Pretty())
+			}else{
+				fmt.Fprintln(stderr, err)
+			}
+			code = exitNoMatch
+		}
+	}
+	return code, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	fileA := filepath.Join(dir, "a.txt")
+	fileB := filepath.Join(dir, "b.txt")
+	os.WriteFile(fileA, []byte("ab\n"), 0640)
+	os.WriteFile(fileB, []byte("cd\n"), 0640)
+
+	tests := []struct {
+		args []string
+		stdin string
+		code int
+		out string
+	}{
+		{[]string{}, "", exitError, ""},
+		{[]string{"unknown"}, "", exitError, ""},
+
+		{[]string{"match", `b`}, "abc", 0, ""},
+		{[]string{"match", `x`}, "abc", exitNoMatch, ""},
+		{[]string{"match"}, "abc", exitError, ""},
+		{[]string{"match", `c`, fileA, fileB}, "", 0, ""},
+		{[]string{"match", `b\nc`, fileA, fileB}, "", exitNoMatch, ""},
+		{[]string{"match", `a`, filepath.Join(dir, "none.txt")}, "", exitError, ""},
+
+		{[]string{"find", `\w`}, "ab", 0, "a\nb\n"},
+		{[]string{"find", "-n", "1", `\w`}, "ab", 0, "a\n"},
+		{[]string{"find", "-g", "1", `(\w)\d`}, "a1 b2", 0, "a\nb\n"},
+		{[]string{"find", "-g", "-1", `(\w)\d`}, "a1", exitError, ""},
+		{[]string{"find", "-g", "2", `(\w)\d`}, "a1", exitError, ""},
+		{[]string{"find", `x`}, "ab", exitNoMatch, ""},
+		{[]string{"find", "-n", "3", `\w`, fileA, fileB}, "", 0, "a\nb\nc\n"},
+		{[]string{"find", `b\nc`, fileA, fileB}, "", exitNoMatch, ""},
+
+		{[]string{"replace", `b`, `x`}, "abc", 0, "axc"},
+		{[]string{"replace", `(\w)b`, `$1$1`}, "ab", 0, "aa"},
+		{[]string{"replace", `b`}, "abc", exitError, ""},
+		{[]string{"replace", "-i", `b`, `x`}, "abc", exitError, ""},
+
+		{[]string{"split", `,`}, "a,b", 0, "a\nb\n"},
+		{[]string{"split", `b\nc`, fileA, fileB}, "", 0, "ab\n\ncd\n\n"},
+
+		{[]string{"escape", `a.b`, `%1`}, "", 0, "a\\.b\n\\%1\n"},
+
+		{[]string{"valid", `a`, `b+`}, "", 0, ""},
+		{[]string{"valid", `a`, `a(`}, "", exitNoMatch, ""},
+	}
+
+	for _, test := range tests {
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+		code := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+
+		if code != test.code {
+			t.Error("[", test.args, "]\n", errors.New("exit code "+strconv.Itoa(code)+" does not match expected result"), stderr.String())
+		}else if stdout.String() != test.out {
+			t.Error("[", test.args, "]\n", errors.New("output "+strconv.Quote(stdout.String())+" does not match expected result"))
+		}
+	}
+}
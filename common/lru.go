@@ -0,0 +1,191 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a cache that removes the least recently used items once it holds too many entries, or too many bytes
+//
+// like CacheMap, each key can store either a value or an error
+type LRU[T any] struct {
+	items map[string]*list.Element
+	order *list.List
+	maxEntries int
+	maxBytes int64
+	bytes int64
+	evictions uint64
+	size func(key string, value T) int64
+	mu sync.Mutex
+	null T
+}
+
+// CacheEntry describes an item in a cache
+type CacheEntry struct {
+	Key string
+	LastUse time.Time
+	// Size is the estimated size of the item in bytes
+	Size int64
+	// Err is the error stored in place of a value
+	Err error
+}
+
+type lruItem[T any] struct {
+	key string
+	value T
+	err error
+	lastUse time.Time
+	size int64
+}
+
+// NewLRU creates a new LRU cache
+//
+// @maxEntries: the max number of items to keep (0 for no limit)
+//
+// @maxBytes: the max estimated size of all items in bytes (0 for no limit)
+//
+// @size: returns the estimated size of an item in bytes
+func NewLRU[T any](maxEntries int, maxBytes int64, size func(key string, value T) int64) *LRU[T] {
+	return &LRU[T]{
+		items: map[string]*list.Element{},
+		order: list.New(),
+		maxEntries: maxEntries,
+		maxBytes: maxBytes,
+		size: size,
+	}
+}
+
+// get returns a value or an error if it exists
+//
+// if the object key does not exist, it will return both a nil/zero value (of the relevant type) and nil error
+func (cache *LRU[T]) Get(key string) (T, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elm, ok := cache.items[key]; ok {
+		item := elm.Value.(*lruItem[T])
+		item.lastUse = time.Now()
+		cache.order.MoveToFront(elm)
+		return item.value, item.err
+	}
+
+	return cache.null, nil
+}
+
+// set sets or adds a new key with either a value, or an error
+//
+// the least recently used items are removed if the cache is over its limits
+func (cache *LRU[T]) Set(key string, value T, err error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elm, ok := cache.items[key]; ok {
+		cache.remove(elm)
+	}
+
+	item := &lruItem[T]{key: key, value: value, err: err, lastUse: time.Now(), size: int64(len(key))}
+	if err == nil && cache.size != nil {
+		item.size = cache.size(key, value)
+	}
+
+	cache.items[key] = cache.order.PushFront(item)
+	cache.bytes += item.size
+
+	for cache.order.Len() > 1 && ((cache.maxEntries > 0 && cache.order.Len() > cache.maxEntries) || (cache.maxBytes > 0 && cache.bytes > cache.maxBytes)) {
+		cache.remove(cache.order.Back())
+		cache.evictions++
+	}
+}
+
+// delete removes a key from the cache
+//
+// this is not counted as an eviction, since the item was removed on request
+func (cache *LRU[T]) Delete(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elm, ok := cache.items[key]; ok {
+		cache.remove(elm)
+	}
+}
+
+// evictions returns the number of items removed because the cache was over its limits, or the items were too old (removed by DelOld)
+//
+// items removed by Delete or Purge are not counted
+func (cache *LRU[T]) Evictions() uint64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.evictions
+}
+
+// snapshot returns a list of every item in the cache, from the most to the least recently used
+func (cache *LRU[T]) Snapshot() []CacheEntry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	res := make([]CacheEntry, 0, cache.order.Len())
+	for elm := cache.order.Front(); elm != nil; elm = elm.Next() {
+		item := elm.Value.(*lruItem[T])
+		res = append(res, CacheEntry{Key: item.key, LastUse: item.lastUse, Size: item.size, Err: item.err})
+	}
+	return res
+}
+
+// len returns the number of items in the cache
+func (cache *LRU[T]) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.order.Len()
+}
+
+// bytes returns the estimated size of all items in the cache
+func (cache *LRU[T]) Bytes() int64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.bytes
+}
+
+// purge removes every item from the cache
+func (cache *LRU[T]) Purge() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.items = map[string]*list.Element{}
+	cache.order.Init()
+	cache.bytes = 0
+}
+
+// delOld removes old cache items
+func (cache *LRU[T]) DelOld(cacheTime time.Duration){
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cacheTime == 0 {
+		cache.evictions += uint64(cache.order.Len())
+		cache.items = map[string]*list.Element{}
+		cache.order.Init()
+		cache.bytes = 0
+		return
+	}
+
+	now := time.Now().UnixNano()
+
+	// items are sorted by last use, so the oldest items are at the back
+	for elm := cache.order.Back(); elm != nil; elm = cache.order.Back() {
+		if now - elm.Value.(*lruItem[T]).lastUse.UnixNano() <= int64(cacheTime) {
+			break
+		}
+		cache.remove(elm)
+		cache.evictions++
+	}
+}
+
+func (cache *LRU[T]) remove(elm *list.Element) {
+	item := cache.order.Remove(elm).(*lruItem[T])
+	delete(cache.items, item.key)
+	cache.bytes -= item.size
+}
@@ -0,0 +1,143 @@
+package regex
+
+import (
+	"context"
+	"errors"
+)
+
+// TimeoutError is returned when a context is canceled, or its deadline is exceeded, before a regex finished running
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return "regex: " + e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout returns true if the error was caused by a deadline being exceeded
+func (e *TimeoutError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// ContextMatchLimit is the max number of internal match calls pcre can make for a single match attempt
+// in the *Context methods (0 for the pcre default)
+//
+// a pcre match attempt that has already started cannot be interrupted, so this limit is what stops the goroutine
+// of a canceled context from running a slow match (ie: from catastrophic backtracking) forever.
+// if a match attempt reaches the limit, the method returns an error.
+// a lower limit set by the regex (with Options.MatchLimit) is still used, and this is ignored by RE2, which runs in linear time.
+// the limit is not used with a context that can never be done (ie: context.Background), because the match then runs on the calling goroutine
+var ContextMatchLimit int = 1000000
+
+// eachContext is the same as each, but it stops early and returns a *TimeoutError if @ctx is done
+//
+// the matches are found one at a time in a separate goroutine, so a single slow match
+// (ie: from catastrophic backtracking) cannot hold up the caller past its deadline.
+// the callback always runs on the calling goroutine.
+//
+// note: a PCRE execution that has already started cannot be interrupted,
+// so the abandoned goroutine will keep running until that single match attempt finishes, or reaches the ContextMatchLimit.
+// the goroutine matches a copy of @str, so the caller can change or reuse its []byte once a *TimeoutError is returned
+func (reg *Regexp) eachContext(ctx context.Context, str []byte, cb func(ind []int) bool) error {
+	if ctx.Done() == nil {
+		return reg.each(str, cb)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &TimeoutError{Err: err}
+	}
+
+	// the indexes are the same in the copy, so the callback can still use the original []byte
+	str = append([]byte{}, str...)
+
+	matches := make(chan []int)
+	done := make(chan struct{})
+	defer close(done)
+
+	limited := reg.withMatchLimit(ContextMatchLimit)
+
+	var matchErr error
+	go func(){
+		defer close(matches)
+		matchErr = limited.each(str, func(ind []int) bool {
+			select {
+			case matches <- ind:
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+
+	for {
+		select {
+		case ind, ok := <-matches:
+			if !ok {
+				return matchErr
+			}
+			if !cb(ind) {
+				return nil
+			}
+		case <-ctx.Done():
+			return &TimeoutError{Err: ctx.Err()}
+		}
+	}
+}
+
+
+//* context methods
+
+// MatchContext is the same as Match, but it returns a *TimeoutError if @ctx is done before a match is found
+func (reg *Regexp) MatchContext(ctx context.Context, str []byte) (bool, error) {
+	found := false
+	err := reg.eachContext(ctx, str, func(ind []int) bool {
+		found = true
+		return false
+	})
+	return found, err
+}
+
+// RepFuncContext is the same as RepFunc, but it returns a *TimeoutError if @ctx is done before it finishes
+//
+// on error, the original []byte is returned unchanged
+func (reg *Regexp) RepFuncContext(ctx context.Context, str []byte, rep func(data func(int) []byte) []byte, blank ...bool) ([]byte, error) {
+	return reg.repFunc(ctx, str, func(ind []int) []byte {
+		return rep(groupData(str, ind))
+	}, len(blank) != 0)
+}
+
+// RepStrContext is the same as RepStr, but it returns a *TimeoutError if @ctx is done before it finishes
+//
+// on error, the original []byte is returned unchanged
+func (reg *Regexp) RepStrContext(ctx context.Context, str []byte, rep []byte) ([]byte, error) {
+	return reg.repFunc(ctx, str, func(ind []int) []byte {
+		return reg.expand(rep, groupData(str, ind))
+	}, false)
+}
+
+// SplitContext is the same as Split, but it returns a *TimeoutError if @ctx is done before it finishes
+func (reg *Regexp) SplitContext(ctx context.Context, str []byte) ([][]byte, error) {
+	return reg.split(ctx, str)
+}
+
+// FindAllContext is the same as FindAll, but it returns a *TimeoutError if @ctx is done before it finishes
+func (reg *Regexp) FindAllContext(ctx context.Context, str []byte, n int) ([][]byte, error) {
+	ind, err := reg.findAll(ctx, str, n, false)
+	if err != nil {
+		return nil, err
+	}
+	return matchValues(str, ind), nil
+}
+
+// FindAllSubmatchContext is the same as FindAllSubmatch, but it returns a *TimeoutError if @ctx is done before it finishes
+func (reg *Regexp) FindAllSubmatchContext(ctx context.Context, str []byte, n int) ([][][]byte, error) {
+	ind, err := reg.findAll(ctx, str, n, true)
+	if err != nil {
+		return nil, err
+	}
+	return subMatchValues(str, ind), nil
+}
@@ -0,0 +1,218 @@
+package regex
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrPatternCycle is returned by Define when a pattern references itself, directly or through other patterns
+var ErrPatternCycle error = errors.New("regex: pattern cycle")
+
+// ErrPatternName is returned by Define when the name of a pattern is not valid
+var ErrPatternName error = errors.New("regex: invalid pattern name")
+
+var defMU sync.RWMutex
+var defList map[string]string = map[string]string{}
+
+// defKey is added to the preprocessor cache key, so a regex is expanded again after a pattern is defined
+//
+// a pattern can be replaced, so a version is kept instead of the length of defList
+var defKey string
+var defVersion int
+
+var regDefName *regexp.Regexp = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+var regDefRef *regexp.Regexp = regexp.MustCompile(`(\\|)%\{([A-Z][A-Z0-9_]*)(?::([A-Za-z_][A-Za-z0-9_]*))?\}`)
+
+// Define adds a reusable pattern, that can be referenced by other patterns with %{NAME} or %{NAME:field}
+//
+// %{NAME} is expanded into a non-capturing group, and %{NAME:field} is expanded into a capture group named field
+//
+// the field names raw, list and class are param modifiers, so %{NAME:list} is always a named param (see CompNamed),
+// and is never expanded into a pattern
+//
+//	regex.Define("IP", `\d{1,3}(?:\.\d{1,3}){3}`)
+//	regex.Comp(`^%{IP:client}$`) // ^(?P<client>(?:\d{1,3}(?:\.\d{1,3}){3}))$
+//
+// @name: must only use upper case letters, digits, and _
+//
+// @re: uses the same syntax as Comp, and can reference other patterns (including ones that are not defined yet).
+// defining a pattern that already exists will replace it
+//
+// an error is returned if the pattern would reference itself
+//
+// a named param passed to CompNamed or CompNamedTry takes precedence over a pattern with the same name,
+// so %{HOST} uses named["HOST"] when it is set. this only applies to the regex passed to CompNamed, not to the patterns it references
+func Define(name string, re string) error {
+	if !regDefName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrPatternName, name)
+	}
+
+	defMU.Lock()
+	defer defMU.Unlock()
+
+	if path := defCycle(name, re, []string{name}); path != nil {
+		return fmt.Errorf("%w: %s", ErrPatternCycle, strings.Join(path, " -> "))
+	}
+
+	defList[name] = re
+
+	// the preprocessor cache holds the old expansion of this pattern, so the key is changed
+	// (purging the cache would not stop another goroutine from adding an expansion it made before this)
+	defVersion++
+	defKey = "\x00def" + strconv.Itoa(defVersion)
+
+	return nil
+}
+
+// DefineFile loads a list of patterns from a file, and adds them with Define
+//
+// each line has a name, followed by whitespace and the pattern.
+// empty lines, and lines starting with #, are skipped
+//
+//	# comment
+//	INT [+-]?\d+
+//	PAIR %{INT:key}=%{INT:val}
+//
+// the patterns before a line with an error are still defined
+func DefineFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		i := strings.IndexAny(text, " \t")
+		if i == -1 {
+			return fmt.Errorf("regex: %s:%d: missing pattern for %q", path, line, text)
+		}
+
+		name, re := text[:i], strings.TrimLeft(text[i:], " \t")
+
+		if err := Define(name, re); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// defCycle returns the list of names that lead back to @name, or nil if there is no cycle
+//
+// @re: the pattern of the last name in @path
+//
+// the lock must be held by the caller
+func defCycle(name string, re string, path []string) []string {
+	for _, ref := range regDefRef.FindAllStringSubmatch(re, -1) {
+		if ref[1] != "" || isParamMod(ref[3]) {
+			continue
+		}
+
+		next := append(append([]string{}, path...), ref[2])
+		if ref[2] == name {
+			return next
+		}
+
+		// the other patterns cannot have a cycle (they were checked when they were defined), so this will not loop
+		if sub, ok := defList[ref[2]]; ok {
+			if res := defCycle(name, sub, next); res != nil {
+				return res
+			}
+		}
+	}
+
+	return nil
+}
+
+// getDefKey returns the part of the preprocessor cache key for the patterns added by Define
+//
+// @named: the names in @named that could be a pattern are added to the key, because expandDefs skips them
+func getDefKey(named map[string]string) string {
+	defMU.RLock()
+	key := defKey
+	defMU.RUnlock()
+
+	names := []string{}
+	for name := range named {
+		if regDefName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return key
+	}
+
+	sort.Strings(names)
+	return key + "\x00named" + strings.Join(names, ",")
+}
+
+// expandDefs expands the references to defined patterns in a regex
+//
+// references to patterns that are not defined are left unchanged
+//
+// @srcMap: if not nil, a map of the offsets is kept in the same way as mappedReplace
+//
+// @named: references with a name in @named are left unchanged, so they are replaced by the named param
+func expandDefs(reB []byte, srcMap []int, named map[string]string) ([]byte, []int) {
+	defMU.RLock()
+	defer defMU.RUnlock()
+
+	if len(defList) == 0 {
+		return reB, srcMap
+	}
+
+	return expandDefsLocked(reB, srcMap, named)
+}
+
+// expandDefsLocked runs expandDefs while the lock is held
+//
+// Define does not allow cycles, so the recursion will always end
+func expandDefsLocked(reB []byte, srcMap []int, named map[string]string) ([]byte, []int) {
+	return mappedReplace(regDefRef, reB, srcMap, func(b []byte) []byte {
+		// escaped references are not replaced
+		if b[0] == '\\' {
+			return b
+		}
+
+		ref := regDefRef.FindSubmatch(b)
+		if isParamMod(string(ref[3])) {
+			return b
+		}
+		if _, ok := named[string(ref[2])]; ok {
+			return b
+		}
+
+		def, ok := defList[string(ref[2])]
+		if !ok {
+			return b
+		}
+
+		sub, _ := expandDefsLocked([]byte(def), nil, nil)
+
+		if len(ref[3]) != 0 {
+			return append(append(append([]byte("(?P<"), ref[3]...), '>'), append(sub, ')')...)
+		}
+		return append(append([]byte("(?:"), sub...), ')')
+	})
+}
+
+// isParamMod returns true if @field is a param modifier (like %{name:list}), which is not a field name of a pattern reference
+func isParamMod(field string) bool {
+	return field == "raw" || field == "list" || field == "class"
+}
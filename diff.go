@@ -0,0 +1,239 @@
+package regex
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a unified diff
+const diffContext = 3
+
+// diffMaxEdits is the most changed lines diffLines will search for (the memory it uses grows with the square of this number)
+//
+// if the files have more changes than this, the changed part is shown as a single removal and addition
+const diffMaxEdits = 2000
+
+// diffOp is a single line of a diff
+//
+// @kind: ' ' for an unchanged line, '-' for a removed line, and '+' for an added line
+type diffOp struct {
+	kind byte
+	line []byte
+}
+
+// unifiedDiff returns a unified diff of two versions of a file, or an empty string if they are the same
+func unifiedDiff(name string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	res := bytes.NewBuffer(nil)
+	res.WriteString("--- a/" + name + "\n")
+	res.WriteString("+++ b/" + name + "\n")
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// find the end of the hunk, merging changes that are close enough to share their context
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}else if j-end >= diffContext*2 {
+				break
+			}
+		}
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		// count the lines before the hunk
+		aStart, bStart := 0, 0
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+
+		aLen, bLen := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+
+		res.WriteString("@@ -" + hunkRange(aStart, aLen) + " +" + hunkRange(bStart, bLen) + " @@\n")
+		for _, op := range ops[start:end] {
+			res.WriteByte(op.kind)
+			res.Write(op.line)
+			if len(op.line) == 0 || op.line[len(op.line)-1] != '\n' {
+				res.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+
+	return res.String()
+}
+
+// hunkRange formats the start line and number of lines of a hunk
+//
+// an empty range starts at the line before it
+func hunkRange(start, n int) string {
+	if n != 0 {
+		start++
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(n)
+}
+
+// splitLines splits a []byte into lines, keeping the '\n' at the end of each line
+func splitLines(b []byte) [][]byte {
+	res := [][]byte{}
+	for len(b) != 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			i = len(b)
+		}
+		res = append(res, b[:i])
+		b = b[i:]
+	}
+	return res
+}
+
+// diffLines returns the shortest list of line changes from @a to @b, using the Myers diff algorithm
+func diffLines(a, b [][]byte) []diffOp {
+	// the common start and end are kept out of the algorithm, so it only has to run on the changed lines
+	pre := 0
+	for pre < len(a) && pre < len(b) && bytes.Equal(a[pre], b[pre]) {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && bytes.Equal(a[len(a)-1-suf], b[len(b)-1-suf]) {
+		suf++
+	}
+
+	res := []diffOp{}
+	for _, line := range a[:pre] {
+		res = append(res, diffOp{' ', line})
+	}
+
+	x, y := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	n, m := len(x), len(y)
+	max := n + m
+
+	// trace stores the furthest reaching x value for each diagonal k, after each number of changes d
+	//
+	// step d only reads the diagonals from -d to d, so only that part of v is kept (trace[d][d+k] is diagonal k)
+	v := make([]int, 2*max+2)
+	trace := [][]int{}
+
+	for d := 0; d <= max; d++ {
+		if d > diffMaxEdits {
+			for _, line := range x {
+				res = append(res, diffOp{'-', line})
+			}
+			for _, line := range y {
+				res = append(res, diffOp{'+', line})
+			}
+			for _, line := range a[len(a)-suf:] {
+				res = append(res, diffOp{' ', line})
+			}
+			return res
+		}
+
+		trace = append(trace, append([]int{}, v[max-d:max+d+1]...))
+
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				i = v[max+k+1]
+			}else{
+				i = v[max+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && bytes.Equal(x[i], y[j]) {
+				i++
+				j++
+			}
+			v[max+k] = i
+
+			if i >= n && j >= m {
+				done = true
+				break
+			}
+		}
+
+		if done {
+			break
+		}
+	}
+
+	// walk back through the trace to build the list of changes
+	ops := []diffOp{}
+	i, j := n, m
+	for d := len(trace) - 1; d >= 0 && (i > 0 || j > 0); d-- {
+		v := trace[d]
+		k := i - j
+
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		}else{
+			prevK = k - 1
+		}
+
+		// at d == 0 there is no previous step, and the rest of the lines are the same
+		prevI := 0
+		if d != 0 {
+			prevI = v[d+prevK]
+		}
+		prevJ := prevI - prevK
+
+		for i > prevI && j > prevJ {
+			i--
+			j--
+			ops = append(ops, diffOp{' ', x[i]})
+		}
+
+		if d == 0 {
+			break
+		}
+
+		if i == prevI {
+			j--
+			ops = append(ops, diffOp{'+', y[j]})
+		}else{
+			i--
+			ops = append(ops, diffOp{'-', x[i]})
+		}
+	}
+
+	for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+		ops[l], ops[r] = ops[r], ops[l]
+	}
+	res = append(res, ops...)
+
+	for _, line := range a[len(a)-suf:] {
+		res = append(res, diffOp{' ', line})
+	}
+
+	return res
+}
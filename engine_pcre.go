@@ -0,0 +1,264 @@
+//go:build cgo && !nopcre
+
+package regex
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/GRbit/go-pcre"
+)
+
+// Engine is the type of the compiled regex stored in the RE field of a Regexp
+//
+// this is pcre.Regexp, or *regexp.Regexp when the module is built with the nopcre tag, or without cgo
+type Engine = pcre.Regexp
+
+// PCRE is an alias of pcre.Regexp
+type PCRE pcre.Regexp
+
+// EngineName is the name of the regex engine this module was built with ("pcre" or "re2")
+const EngineName = "pcre"
+
+// canPartial is true when the match method supports partial matching
+const canPartial = true
+
+// engineData holds extra data an engine needs for a compiled regex
+type engineData struct {
+	// code is the same regex compiled by this module, which is used to search from an offset
+	code *pcreCode
+	// matchLimit lowers the pcre match limit of each search (0 for no change)
+	matchLimit int
+}
+
+// compile compiles a regex that has already been through compRE
+func compile(re string, opts Options) (*Regexp, error) {
+	flags := pcre.UTF8
+	if opts.CaseInsensitive {
+		flags |= pcre.CASELESS
+	}
+	if opts.Multiline {
+		flags |= pcre.MULTILINE
+	}
+	if opts.DotAll {
+		flags |= pcre.DOTALL
+	}
+	if opts.Extended {
+		flags |= pcre.EXTENDED
+	}
+	if opts.Ungreedy {
+		flags |= pcre.UNGREEDY
+	}
+	if opts.DollarEndOnly {
+		flags |= pcre.DOLLAR_ENDONLY
+	}
+	if opts.UCP {
+		flags |= pcre.UCP
+	}
+
+	pattern := re
+	if opts.RecursionLimit > 0 {
+		pattern = "(*LIMIT_RECURSION=" + strconv.Itoa(opts.RecursionLimit) + ")" + pattern
+	}
+	if opts.MatchLimit > 0 {
+		pattern = "(*LIMIT_MATCH=" + strconv.Itoa(opts.MatchLimit) + ")" + pattern
+	}
+
+	reg, err := pcre.Compile(pattern, flags)
+	if err != nil {
+		return nil, pcreCompileError(err, pattern, len(pattern)-len(re))
+	}
+
+	// commented below methods compiled 10000 times in 0.1s (above method being used finished in half of that time)
+	// reg := pcre.MustCompileParse(re)
+	// reg := pcre.MustCompileJIT(re, pcre.UTF8, pcre.STUDY_JIT_COMPILE)
+	// reg := pcre.MustCompileJIT(re, pcre.EXTRA, pcre.STUDY_JIT_COMPILE)
+	// reg := pcre.MustCompileJIT(re, pcre.JAVASCRIPT_COMPAT, pcre.STUDY_JIT_COMPILE)
+	// reg := pcre.MustCompileParseJIT(re, pcre.STUDY_JIT_COMPILE)
+
+	study := 0
+	if opts.JIT {
+		// the partial hard flag is needed for the JIT to also be used by the streaming methods
+		// if the JIT is not available, keep the normal compiled regex
+		if regJIT, err := pcre.CompileJIT(pattern, flags, pcre.STUDY_JIT_COMPILE|pcre.STUDY_JIT_PARTIAL_HARD_COMPILE); err == nil {
+			reg = regJIT
+			study = pcre.STUDY_JIT_COMPILE|pcre.STUDY_JIT_PARTIAL_HARD_COMPILE
+		}
+	}
+
+	code, err := pcreCompile(pattern, flags, study)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Regexp{RE: reg, len: int64(len(re)), names: code.names, engine: engineData{code: code}}, nil
+}
+
+// pcreCompileError converts an error from pcre.Compile into a *CompileError
+//
+// pcre formats compile errors as "pattern (offset): message"
+//
+// @prefix: the length of the (*LIMIT) options added to the start of the pattern
+func pcreCompileError(err error, pattern string, prefix int) *CompileError {
+	cerr := &CompileError{Message: err.Error(), ExpandedOffset: -1, Err: err}
+
+	msg := strings.TrimPrefix(err.Error(), pattern+" (")
+	if i := strings.Index(msg, "): "); i != -1 && len(msg) != len(err.Error()) {
+		if offset, e := strconv.Atoi(msg[:i]); e == nil {
+			cerr.Message = msg[i+3:]
+			cerr.ExpandedOffset = offset - prefix
+			if cerr.ExpandedOffset < 0 {
+				cerr.ExpandedOffset = 0
+			}
+		}
+	}
+
+	cerr.Code = pcreErrorCodes[cerr.Message]
+	return cerr
+}
+
+// pcreErrorCodes is the pcre compile error code of each error message
+//
+// the go-pcre module only returns the message, so the code is found from the error texts of pcre_compile.c
+var pcreErrorCodes = map[string]int{
+	"\\ at end of pattern": 1,
+	"\\c at end of pattern": 2,
+	"unrecognized character follows \\": 3,
+	"numbers out of order in {} quantifier": 4,
+	"number too big in {} quantifier": 5,
+	"missing terminating ] for character class": 6,
+	"invalid escape sequence in character class": 7,
+	"range out of order in character class": 8,
+	"nothing to repeat": 9,
+	"internal error: unexpected repeat": 11,
+	"unrecognized character after (? or (?-": 12,
+	"POSIX named classes are supported only within a class": 13,
+	"missing )": 14,
+	"reference to non-existent subpattern": 15,
+	"missing ) after comment": 18,
+	"regular expression is too large": 20,
+	"failed to get memory": 21,
+	"unmatched parentheses": 22,
+	"internal error: code overflow": 23,
+	"unrecognized character after (?<": 24,
+	"lookbehind assertion is not fixed length": 25,
+	"malformed number or name after (?(": 26,
+	"conditional group contains more than two branches": 27,
+	"assertion expected after (?(": 28,
+	"(?R or (?[+-]digits must be followed by )": 29,
+	"unknown POSIX class name": 30,
+	"POSIX collating elements are not supported": 31,
+	"character value in \\x{} or \\o{} is too large": 34,
+	"invalid condition (?(0)": 35,
+	"\\C not allowed in lookbehind assertion": 36,
+	"PCRE does not support \\L, \\l, \\N{name}, \\U, or \\u": 37,
+	"number after (?C is > 255": 38,
+	"closing ) for (?C expected": 39,
+	"recursive call could loop indefinitely": 40,
+	"unrecognized character after (?P": 41,
+	"syntax error in subpattern name (missing terminator)": 42,
+	"two named subpatterns have the same name": 43,
+	"invalid UTF-8 string": 44,
+	"malformed \\P or \\p sequence": 46,
+	"unknown property name after \\P or \\p": 47,
+	"subpattern name is too long (maximum 32 characters)": 48,
+	"too many named subpatterns (maximum 10000)": 49,
+	"DEFINE group contains more than one branch": 54,
+	"inconsistent NEWLINE options": 56,
+	"\\g is not followed by a braced, angle-bracketed, or quoted name/number or by a plain number": 57,
+	"a numbered reference must not be zero": 58,
+	"an argument is not allowed for (*ACCEPT), (*FAIL), or (*COMMIT)": 59,
+	"(*VERB) not recognized or malformed": 60,
+	"number is too big": 61,
+	"subpattern name expected": 62,
+	"digit expected after (?+": 63,
+	"different names for subpatterns of the same number are not allowed": 65,
+	"(*MARK) must have an argument": 66,
+	"\\c must be followed by an ASCII character": 68,
+	"\\k is not followed by a braced, angle-bracketed, or quoted name": 69,
+	"\\N is not supported in a class": 71,
+	"too many forward references": 72,
+	"disallowed Unicode code point (>= 0xd800 && <= 0xdfff)": 73,
+	"name is too long in (*MARK), (*PRUNE), (*SKIP), or (*THEN)": 75,
+	"non-hex character in \\x{} (closing brace missing?)": 79,
+	"non-octal character in \\o{} (closing brace missing?)": 80,
+	"missing opening brace after \\o": 81,
+	"parentheses are too deeply nested": 82,
+	"invalid range in character class": 83,
+	"group name must start with a non-digit": 84,
+	"parentheses are too deeply nested (stack check)": 85,
+	"digits missing in \\x{} or \\o{}": 86,
+	"regular expression is too complicated": 87,
+}
+
+// match finds the first match in a []byte, starting from @offset, and returns the index pairs of the match and its capture groups
+//
+// the full []byte is passed to pcre, so the bytes before @offset can be used by lookbehinds, \b and ^ (with the multiline option).
+// a capture group that did not participate in the match has the indexes -1, -1
+//
+// @partial: if true, a match that reaches the end of @str before it can finish will be returned with isPartial set to true,
+// and only the start and end index of the partial match
+//
+// @checked: if true, an earlier search of the same @str already checked it for invalid utf8,
+// so pcre does not need to read all of it again
+func (reg *Regexp) match(str []byte, offset int, partial bool, checked bool) (ind []int, isPartial bool, err error) {
+	if offset > len(str) {
+		return nil, false, nil
+	}
+
+	flags := 0
+	if partial {
+		flags |= pcre.PARTIAL_HARD
+	}
+	if checked {
+		flags |= pcre.NO_UTF8_CHECK
+	}
+
+	return reg.engine.code.exec(str, offset, flags, reg.engine.matchLimit)
+}
+
+// withMatchLimit returns a copy of a Regexp that stops each match attempt after @limit internal match calls,
+// and returns an error
+//
+// a lower limit set by the regex (with Options.MatchLimit) is still used
+func (reg *Regexp) withMatchLimit(limit int) *Regexp {
+	res := *reg
+	res.engine.matchLimit = limit
+	return &res
+}
+
+// lookbehind returns the max number of chars before the start of a search that can change its result
+func (reg *Regexp) lookbehind() int {
+	return reg.engine.code.lookbehind
+}
+
+// Match returns true if a []byte matches a regex
+func (reg *Regexp) Match(str []byte) bool {
+	ind, _, err := reg.match(str, 0, false, false)
+	return err == nil && ind != nil
+}
+
+// RepStrLit replaces a string with another string
+//
+// note: this function is optimized for performance, and the replacement string does not accept replacements like $1
+func (reg *Regexp) RepStrLit(str []byte, rep []byte) []byte {
+	// the go-pcre module searches the rest of the input without the text before it after each match,
+	// so the matches are found with the pcre code of this module instead
+	if rep == nil {
+		rep = []byte{}
+	}
+
+	res, _ := reg.repFunc(context.Background(), str, func(ind []int) []byte {
+		return rep
+	}, false)
+	return res
+}
+
+// IsValidPCRE will return true if a regex is valid and can be compiled by the PCRE module
+func IsValidPCRE(re string) bool {
+	if _, err := pcre.Compile(re, pcre.UTF8); err == nil {
+		return true
+	}
+	return false
+}
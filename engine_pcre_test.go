@@ -0,0 +1,85 @@
+//go:build cgo && !nopcre
+
+package regex
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEnginePCRE(t *testing.T) {
+	if res := Comp(`a|(?<=a)b`).FindAllIndex([]byte("abab"), -1); len(res) != 4 || res[1][0] != 1 {
+		t.Error("[", res, "]\n", errors.New("lookbehind did not use the text before the search"))
+	}
+
+	// without the multiline option, ^ only matches at the start of the input
+	if res := Comp(`^a|\n`).FindAllIndex([]byte("a\na"), -1); len(res) != 2 {
+		t.Error("[", res, "]\n", errors.New("^ matched after a newline without the multiline option"))
+	}
+	if res := CompOpts(`^a`, Options{Multiline: true}).FindAllIndex([]byte("a\na"), -1); len(res) != 2 {
+		t.Error("[", res, "]\n", errors.New("^ did not match after a newline with the multiline option"))
+	}
+
+	if res := Comp(`^a`).RepStrLit([]byte("aaa"), []byte("b")); string(res) != "baa" {
+		t.Error("[", string(res), "]\n", errors.New("^ matched after the start of the input"))
+	}
+	if res := Comp(`a|(?<=a)b`).RepStrLit([]byte("abab"), nil); len(res) != 0 {
+		t.Error("[", string(res), "]\n", errors.New("lookbehind did not use the text before the search"))
+	}
+
+	if !Comp(`(?<=a)b`).Match([]byte("ab")) || Comp(`(?<=a)b`).Match([]byte("cb")) {
+		t.Error("[", `(?<=a)b`, "]\n", errors.New("match result does not match expected result"))
+	}
+
+	reg := Comp(`(?<=a)b|^c`)
+	out := bytes.NewBuffer(nil)
+	if err := reg.RepReader(bytes.NewReader([]byte("ababc\nc")), out, []byte("x")); err != nil || out.String() != string(reg.RepStrLit([]byte("ababc\nc"), []byte("x"))) {
+		t.Error("[", out.String(), err, "]\n", errors.New("stream result does not match RepStrLit"))
+	}
+
+	// a lookbehind that crosses the boundary between two scans of the stream buffer needs all of its chars as context,
+	// and the context must start at the start of a multi-byte char
+	reg = Comp(`(?<=abc)d|(?<=é)é`)
+	for _, size := range []int64{0, 1024} {
+		for i := 0; i < 8; i++ {
+			str := []byte(strings.Repeat("x", i) + strings.Repeat("é", int(repWriterChunk+size)/2-2) + "abcdéé")
+			out.Reset()
+			if err := reg.RepReader(bytes.NewReader(str), out, []byte("-"), size); err != nil || !bytes.Equal(out.Bytes(), reg.RepStr(str, []byte("-"))) {
+				t.Error("[", size, i, err, "]\n", errors.New("stream result does not match RepStr"))
+			}
+		}
+	}
+
+	// RepFileStr streams the file in the same way, with no limit to the length of a match
+	name := filepath.Join(t.TempDir(), "test.txt")
+	for i := 0; i < 8; i++ {
+		str := []byte(strings.Repeat("x", i) + strings.Repeat("é", repWriterChunk/2-2) + "abcdéé")
+		if err := os.WriteFile(name, str, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.RepFileStr(name, []byte("-"), true); err != nil {
+			t.Error("[", name, "]\n", err)
+		}else if res, _ := os.ReadFile(name); !bytes.Equal(res, reg.RepStr(str, []byte("-"))) {
+			t.Error("[", strconv.Itoa(i), "]\n", errors.New("file result does not match RepStr"))
+		}
+	}
+
+	// the names come from pcre, so they follow the numbering of branch reset groups, (?x) comments and duplicate names
+	if names := Comp(`(?|(?<a>x)|(y))(?<b>z)`).SubexpNames(); len(names) != 3 || names[1] != "a" || names[2] != "b" {
+		t.Error("[", names, "]\n", errors.New("branch reset group names do not match expected result"))
+	}
+	if names := Comp("(?x)(a) # (b)\n(?<c>c)").SubexpNames(); len(names) != 3 || names[1] != "" || names[2] != "c" {
+		t.Error("[", names, "]\n", errors.New("extended mode group names do not match expected result"))
+	}
+	if names := Comp(`(?J)(?<n>a)|(?<n>b)`).SubexpNames(); len(names) != 3 || names[1] != "n" || names[2] != "n" {
+		t.Error("[", names, "]\n", errors.New("duplicate group names do not match expected result"))
+	}
+	if names := Comp(`(*UTF8)(?<=(?<a>d))(?'b'e)`).SubexpNames(); len(names) != 3 || names[1] != "a" || names[2] != "b" {
+		t.Error("[", names, "]\n", errors.New("group names do not match expected result"))
+	}
+}
@@ -0,0 +1,164 @@
+//go:build !cgo || nopcre
+
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Engine is the type of the compiled regex stored in the RE field of a Regexp
+//
+// this is *regexp.Regexp when the module is built with the nopcre tag (or without cgo), or pcre.Regexp otherwise
+type Engine = *regexp.Regexp
+
+// PCRE is an alias of regexp.Regexp, because pcre is not available when built with the nopcre tag (or without cgo)
+type PCRE regexp.Regexp
+
+// EngineName is the name of the regex engine this module was built with ("pcre" or "re2")
+const EngineName = "re2"
+
+// canPartial is true when the match method supports partial matching
+const canPartial = false
+
+// engineData holds extra data an engine needs for a compiled regex
+type engineData struct {
+	// ctx matches the regex after a 1 byte prefix, so the byte before the start of a search
+	// can be used for ^ and \b, in place of the pcre NOTBOL flag
+	ctx *regexp.Regexp
+}
+
+// regPCREOnly finds syntax that pcre supports, but the builtin RE2 module does not
+var regPCREOnly []struct{re *regexp.Regexp; name string} = []struct{re *regexp.Regexp; name string}{
+	{regexp.MustCompile(`\(\?[=!]`), "lookahead"},
+	{regexp.MustCompile(`\(\?<[=!]`), "lookbehind"},
+	{regexp.MustCompile(`\(\?>`), "atomic group"},
+	{regexp.MustCompile(`\(\?\|`), "branch reset group"},
+	{regexp.MustCompile(`\(\?\(`), "conditional group"},
+	{regexp.MustCompile(`\(\?(?:R|[+-]?[0-9]+|&\w+|P>\w+)\)`), "recursion"},
+	{regexp.MustCompile(`\(\?'\w+'`), "(?'name') capture group"},
+	{regexp.MustCompile(`\(\?[a-zA-Z]*[xXJD][a-zA-Z]*[:)]`), "pcre only flag"},
+	{regexp.MustCompile(`\(\*[A-Z]`), "backtracking verb"},
+	{regexp.MustCompile(`(?:^|[^\\])(?:\\\\)*\\(?:[1-9]|k[<'{]|g[0-9{<'+-]|\(\?P=)`), "backreference"},
+	{regexp.MustCompile(`(?:^|[^\\])(?:\\\\)*\\[GKRXhHNZC]`), "pcre only escape"},
+	{regexp.MustCompile(`(?:^|[^\\])(?:\\\\)*\\[pP]\{\^`), "negated unicode property"},
+	{regexp.MustCompile(`[^\\][*+?}]\+`), "possessive quantifier"},
+}
+
+// compile compiles a regex that has already been through compRE
+func compile(re string, opts Options) (*Regexp, error) {
+	if opts.Extended {
+		return nil, fmt.Errorf("%w: extended option", ErrPCREOnly)
+	}else if opts.DollarEndOnly {
+		return nil, fmt.Errorf("%w: dollar end only option", ErrPCREOnly)
+	}else if opts.UCP {
+		return nil, fmt.Errorf("%w: ucp option", ErrPCREOnly)
+	}
+
+	// JIT, MatchLimit and RecursionLimit are ignored, because RE2 runs in linear time
+	prefix := 0
+	if flags := opts.flags(); flags != "" {
+		re = "(?" + flags + ")" + re
+		prefix = len(flags) + 3
+	}
+
+	reg, err := regexp.Compile(re)
+	if err != nil {
+		cerr := re2CompileError(err, re, prefix)
+		for _, p := range regPCREOnly {
+			if p.re.MatchString(re) {
+				cerr.Err = fmt.Errorf("%w: %s: %s", ErrPCREOnly, p.name, err.Error())
+				cerr.Message = p.name + " is only supported by pcre"
+				break
+			}
+		}
+		return nil, cerr
+	}
+
+	ctx, err := regexp.Compile(`\A(?s:.)(?s:.*?)(` + re + `)`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Regexp{RE: reg, len: int64(len(re)), names: reg.SubexpNames(), engine: engineData{ctx: ctx}}, nil
+}
+
+// re2CompileError converts an error from regexp.Compile into a *CompileError
+//
+// RE2 only returns the part of the pattern with the error, so the offset is the first place that part is found
+//
+// @prefix: the length of the flags added to the start of the pattern
+func re2CompileError(err error, pattern string, prefix int) *CompileError {
+	cerr := &CompileError{Message: err.Error(), ExpandedOffset: -1, Err: err}
+
+	if serr, ok := err.(*syntax.Error); ok {
+		cerr.Message = string(serr.Code)
+		if i := strings.Index(pattern[prefix:], serr.Expr); i != -1 {
+			cerr.ExpandedOffset = i
+		}
+	}
+
+	return cerr
+}
+
+// match finds the first match in a []byte, starting from @offset, and returns the index pairs of the match and its capture groups
+//
+// the bytes before @offset are only used as context for things like ^ and \b.
+// a capture group that did not participate in the match has the indexes -1, -1
+//
+// @partial: RE2 does not support partial matching, so this is ignored, and isPartial is always false
+//
+// @checked: only used by pcre, to skip checking @str for invalid utf8 again
+func (reg *Regexp) match(str []byte, offset int, partial bool, checked bool) (ind []int, isPartial bool, err error) {
+	if offset == 0 {
+		return reg.RE.FindSubmatchIndex(str), false, nil
+	}
+
+	if offset > len(str) {
+		return nil, false, nil
+	}
+
+	ind = reg.engine.ctx.FindSubmatchIndex(str[offset-1:])
+	if ind == nil {
+		return nil, false, nil
+	}
+
+	ind = ind[2:]
+	shiftIndex(ind, offset-1)
+	return ind, false, nil
+}
+
+// withMatchLimit returns a Regexp that stops each match attempt after @limit internal match calls
+//
+// RE2 runs in linear time, so the same Regexp is returned
+func (reg *Regexp) withMatchLimit(limit int) *Regexp {
+	return reg
+}
+
+// lookbehind returns the max number of chars before the start of a search that can change its result
+//
+// RE2 has no lookbehinds, and only the char before the start of a search is used for ^ and \b
+func (reg *Regexp) lookbehind() int {
+	return 1
+}
+
+// Match returns true if a []byte matches a regex
+func (reg *Regexp) Match(str []byte) bool {
+	return reg.RE.Match(str)
+}
+
+// RepStrLit replaces a string with another string
+//
+// note: this function is optimized for performance, and the replacement string does not accept replacements like $1
+func (reg *Regexp) RepStrLit(str []byte, rep []byte) []byte {
+	return reg.RE.ReplaceAllLiteral(str, rep)
+}
+
+// IsValidPCRE will return true if a regex is valid and can be compiled by the PCRE module
+//
+// note: this always returns false when built with the nopcre tag (or without cgo), because the PCRE module is not available
+func IsValidPCRE(re string) bool {
+	return false
+}
@@ -0,0 +1,34 @@
+//go:build !cgo || nopcre
+
+package regex
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEngineRE2(t *testing.T) {
+	var check = func(re string) {
+		if _, err := CompTry(re); !errors.Is(err, ErrPCREOnly) {
+			t.Error("[", re, "]\n", errors.New("pcre only syntax did not return ErrPCREOnly"), err)
+		}
+	}
+
+	check(`a(?=b)`)
+	check(`(?<!a)b`)
+	check(`(\w)\1`)
+	check(`a++`)
+	check(`(?>a)`)
+
+	if _, err := CompTry(`a(b`); err == nil || errors.Is(err, ErrPCREOnly) {
+		t.Error("[a(b]\n", errors.New("invalid regex should return a normal error"), err)
+	}
+
+	if IsValidPCRE(`a`) {
+		t.Error("[a]\n", errors.New("IsValidPCRE should be false without pcre"))
+	}
+
+	if res := Comp(`\bb`).FindAllIndex([]byte("ab b"), -1); len(res) != 1 || res[0][0] != 3 {
+		t.Error("[", res, "]\n", errors.New("word boundary did not use the previous char"))
+	}
+}
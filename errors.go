@@ -0,0 +1,134 @@
+package regex
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CompileError is returned by CompTry (and the other compile methods) when a regex fails to compile
+//
+// the regex engine only sees the pattern after compRE expanded it,
+// so the offset of the error is mapped back to the original pattern
+type CompileError struct {
+	// Message is the error message from the regex engine
+	Message string
+
+	// Code is the pcre compile error code (0 if it is not known, or the module was built without pcre)
+	Code int
+
+	// Offset is the byte offset of the error in the original pattern (-1 if it is not known)
+	Offset int
+
+	// Pattern is the original pattern passed to the compile method
+	Pattern string
+
+	// Expanded is the pattern after comments, params and other extended syntax was expanded,
+	// which is the pattern the regex engine tried to compile
+	Expanded string
+
+	// ExpandedOffset is the byte offset of the error in the expanded pattern (-1 if it is not known)
+	ExpandedOffset int
+
+	// Err is the original error returned by the regex engine
+	Err error
+}
+
+func (e *CompileError) Error() string {
+	if e.Offset < 0 {
+		return "regex: " + e.Message
+	}
+	return "regex: " + e.Message + " at offset " + strconv.Itoa(e.Offset)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// Pretty returns the error message, followed by the line of the original pattern with the error,
+// and a caret (^) under the position of the error
+//
+//	regex: missing ) at offset 6
+//	a(b(c)
+//	      ^
+func (e *CompileError) Pretty() string {
+	if e.Offset < 0 || e.Offset > len(e.Pattern) {
+		return e.Error() + "\n" + e.Pattern
+	}
+
+	start := strings.LastIndexByte(e.Pattern[:e.Offset], '\n') + 1
+	end := strings.IndexByte(e.Pattern[e.Offset:], '\n')
+	if end == -1 {
+		end = len(e.Pattern)
+	}else{
+		end += e.Offset
+	}
+
+	// tabs are kept in the padding, so the caret lines up with the pattern
+	pad := []byte{}
+	for _, c := range e.Pattern[start:e.Offset] {
+		if c == '\t' {
+			pad = append(pad, '\t')
+		}else{
+			pad = append(pad, ' ')
+		}
+	}
+
+	return e.Error() + "\n" + e.Pattern[start:end] + "\n" + string(pad) + "^"
+}
+
+// compileError converts an error returned by compile into a *CompileError,
+// with the offset mapped back to the original pattern
+//
+// @re: the original pattern
+//
+// @expanded: the pattern returned by compRE
+func compileError(err error, re string, params []string, named map[string]string, expanded string) error {
+	cerr := engineError(err)
+
+	cerr.Pattern = re
+	cerr.Expanded = expanded
+	cerr.Offset = -1
+
+	if cerr.ExpandedOffset >= 0 {
+		srcMap := compREMap(re, params, named)
+		if cerr.ExpandedOffset < len(srcMap) {
+			cerr.Offset = runeOffset(re, srcMap[cerr.ExpandedOffset])
+		}
+	}
+
+	return cerr
+}
+
+// rawCompileError is the same as compileError, for a regex that was not expanded by compRE
+func rawCompileError(err error, re string) error {
+	cerr := engineError(err)
+
+	cerr.Pattern = re
+	cerr.Expanded = re
+	cerr.Offset = -1
+	if cerr.ExpandedOffset >= 0 && cerr.ExpandedOffset <= len(re) {
+		cerr.Offset = runeOffset(re, cerr.ExpandedOffset)
+	}
+
+	return cerr
+}
+
+// engineError returns a new *CompileError for an error returned by compile
+//
+// the error from the engine can be shared by the cache, so it is copied instead of changed
+func engineError(err error) *CompileError {
+	if cerr, ok := err.(*CompileError); ok {
+		res := *cerr
+		return &res
+	}
+	return &CompileError{Message: strings.TrimPrefix(err.Error(), "regex: "), ExpandedOffset: -1, Err: err}
+}
+
+// runeOffset moves an offset back to the start of the utf8 char it is in
+func runeOffset(str string, offset int) int {
+	for offset > 0 && offset < len(str) && !utf8.RuneStart(str[offset]) {
+		offset--
+	}
+	return offset
+}
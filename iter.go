@@ -0,0 +1,26 @@
+package regex
+
+//* regex iterator methods
+
+// AllFunc runs a callback with every match of the regex, in order
+//
+// matches are found one at a time from the end of the last match,
+// so returning false from @yield stops the search without looking at the rest of @str
+//
+// this is the callback form of All, for go versions without range over func
+func (reg *Regexp) AllFunc(str []byte, yield func(match []byte) bool) {
+	reg.each(str, func(ind []int) bool {
+		return yield(str[ind[0]:ind[1]:ind[1]])
+	})
+}
+
+// AllSubmatchesFunc runs a callback with the index pairs and values of every match and its capture groups, in order
+//
+// a capture group that did not participate in the match has the indexes -1, -1 and a nil value
+//
+// this is the callback form of AllSubmatches, for go versions without range over func
+func (reg *Regexp) AllSubmatchesFunc(str []byte, yield func(ind []int, match [][]byte) bool) {
+	reg.each(str, func(ind []int) bool {
+		return yield(ind, subMatches(str, ind))
+	})
+}
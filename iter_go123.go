@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package regex
+
+import (
+	"iter"
+)
+
+// All returns an iterator over every match of the regex
+//
+// matches are found one at a time from the end of the last match, so breaking out of the loop stops the search
+//
+//	for match := range regex.Comp(`re`).All(str) {}
+func (reg *Regexp) All(str []byte) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		reg.AllFunc(str, yield)
+	}
+}
+
+// AllSubmatches returns an iterator over the index pairs and values of every match and its capture groups
+//
+// a capture group that did not participate in the match has the indexes -1, -1 and a nil value
+//
+//	for ind, match := range regex.Comp(`re (capture)`).AllSubmatches(str) {}
+func (reg *Regexp) AllSubmatches(str []byte) iter.Seq2[[]int, [][]byte] {
+	return func(yield func([]int, [][]byte) bool) {
+		reg.AllSubmatchesFunc(str, yield)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build go1.23
+
+package regex
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	res := []string{}
+	for match := range Comp(`\d+`).All([]byte("1 22 333 4444")) {
+		res = append(res, string(match))
+		if len(res) == 3 {
+			break
+		}
+	}
+	if len(res) != 3 || res[0] != "1" || res[2] != "333" {
+		t.Error("[", res, "]\n", errors.New("iterator does not match expected result"))
+	}
+
+	n := 0
+	for ind, match := range Comp(`(\w)(\d)?`).AllSubmatches([]byte("a1 b")) {
+		if n == 0 && (ind[4] != 1 || string(match[2]) != "1") {
+			t.Error("[", ind, "]\n", errors.New("submatch iterator does not match expected result"))
+		}else if n == 1 && (ind[4] != -1 || match[2] != nil || string(match[1]) != "b") {
+			t.Error("[", ind, "]\n", errors.New("submatch iterator does not match expected result"))
+		}
+		n++
+	}
+	if n != 2 {
+		t.Error("[", n, "]\n", errors.New("submatch iterator did not find every match"))
+	}
+}
@@ -0,0 +1,97 @@
+package regex
+
+import (
+	"strconv"
+)
+
+// Options are extra flags used to compile a regex with CompOpts
+//
+// the zero value uses the same flags as Comp
+type Options struct {
+	// CaseInsensitive is the same as the (?i) flag
+	CaseInsensitive bool
+
+	// Multiline makes ^ and $ match at the start and end of each line (same as the (?m) flag)
+	Multiline bool
+
+	// DotAll makes . also match newlines (same as the (?s) flag)
+	DotAll bool
+
+	// Extended ignores whitespace, and allows # comments in the regex (same as the (?x) flag)
+	//
+	// note: this is only supported by pcre
+	Extended bool
+
+	// Ungreedy swaps the greediness of quantifiers, so * is lazy and *? is greedy (same as the (?U) flag)
+	Ungreedy bool
+
+	// DollarEndOnly makes $ only match at the very end of the string, and not before a final newline
+	//
+	// note: this is only supported by pcre
+	DollarEndOnly bool
+
+	// UCP makes \w, \d, \s and \b use unicode properties, in place of only ascii chars
+	//
+	// note: this is only supported by pcre
+	UCP bool
+
+	// JIT compiles the regex to machine code, which is slower to compile, but much faster to run.
+	// this is best for regex that are used many times.
+	//
+	// if JIT is not available, the regex is compiled normally (this option is ignored without pcre)
+	JIT bool
+
+	// MatchLimit sets the max number of internal match calls pcre can make for a single match attempt,
+	// to stop catastrophic backtracking (0 for the pcre default)
+	//
+	// this option is ignored without pcre, because RE2 does not backtrack
+	MatchLimit int
+
+	// RecursionLimit sets the max depth of recursion pcre can use for a single match attempt (0 for the pcre default)
+	//
+	// this option is ignored without pcre
+	RecursionLimit int
+}
+
+// key returns a string that is added to the cache key of a regex compiled with these options
+//
+// the zero value returns an empty string, so Comp and CompOpts with no options share the same cache
+func (opts Options) key() string {
+	if opts == (Options{}) {
+		return ""
+	}
+
+	flags := opts.flags()
+	if opts.DollarEndOnly {
+		flags += "D"
+	}
+	if opts.UCP {
+		flags += "u"
+	}
+	if opts.JIT {
+		flags += "j"
+	}
+
+	return "\x00" + flags + "\x00" + strconv.Itoa(opts.MatchLimit) + "\x00" + strconv.Itoa(opts.RecursionLimit)
+}
+
+// flags returns the inline flags for the options that have one
+func (opts Options) flags() string {
+	flags := ""
+	if opts.CaseInsensitive {
+		flags += "i"
+	}
+	if opts.Multiline {
+		flags += "m"
+	}
+	if opts.DotAll {
+		flags += "s"
+	}
+	if opts.Extended {
+		flags += "x"
+	}
+	if opts.Ungreedy {
+		flags += "U"
+	}
+	return flags
+}
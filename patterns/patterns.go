@@ -0,0 +1,177 @@
+// patterns is a catalog of common regex patterns, compiled through the regex cache
+//
+// every pattern is anchored to the start and end of the input, and works with both pcre and the nopcre (RE2) build
+package patterns
+
+import (
+	"strings"
+
+	"github.com/AspieSoft/go-regex/v8"
+)
+
+//* pattern parts
+
+// hex is a single group of an IPv6 address
+const hex = `[0-9A-Fa-f]{1,4}`
+
+// octet is a number from 0 to 255, without leading zeros
+const octet = `(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`
+
+// label is a single label of a hostname (up to 63 letters, digits or hyphens, which does not start or end with a hyphen)
+const label = `[0-9A-Za-z](?:[0-9A-Za-z\-]{0,61}[0-9A-Za-z])?`
+
+const ipv4 = octet + `(?:\.` + octet + `){3}`
+
+const ipv6 = `(?:` +
+	// uncompressed
+	`(?:` + hex + `:){7}` + hex +
+	`|(?:` + hex + `:){6}` + ipv4 +
+
+	// compressed with ::
+	`|(?:` + hex + `:){1,7}:` +
+	`|(?:` + hex + `:){1,6}:` + hex +
+	`|(?:` + hex + `:){1,5}(?::` + hex + `){1,2}` +
+	`|(?:` + hex + `:){1,4}(?::` + hex + `){1,3}` +
+	`|(?:` + hex + `:){1,3}(?::` + hex + `){1,4}` +
+	`|(?:` + hex + `:){1,2}(?::` + hex + `){1,5}` +
+	`|` + hex + `:(?::` + hex + `){1,6}` +
+	`|:(?:(?::` + hex + `){1,7}|:)` +
+
+	// compressed with :: and an IPv4 address in the last 32 bits
+	`|::(?:` + hex + `:){0,5}` + ipv4 +
+	`|(?:` + hex + `:){1}:(?:` + hex + `:){0,4}` + ipv4 +
+	`|(?:` + hex + `:){2}:(?:` + hex + `:){0,3}` + ipv4 +
+	`|(?:` + hex + `:){3}:(?:` + hex + `:){0,2}` + ipv4 +
+	`|(?:` + hex + `:){4}:(?:` + hex + `:)?` + ipv4 +
+	`|(?:` + hex + `:){5}:` + ipv4 +
+	`)`
+
+const hostname = label + `(?:\.` + label + `)*`
+
+//* patterns
+
+// Email matches an email address with a dot-atom local part, and a domain with a top level domain of letters
+//
+// quoted local parts and IP address domains are not supported
+var Email *regex.Regexp = regex.Comp(`\A[0-9A-Za-z!#$&'*+/=?\^_{|}~\-]+(?:\.[0-9A-Za-z!#$&'*+/=?\^_{|}~\-]+)*@(?:` + label + `\.)+[A-Za-z]{2,63}\z`)
+
+// URL matches an http, https, ftp, ftps, ws or wss URL
+//
+// the host can be a hostname, an IPv4 address, or an IPv6 address in brackets
+var URL *regex.Regexp = regex.Comp(`\A(?i:https?|ftps?|wss?)://(?:[^\s:@/]+(?::[^\s@/]*)?@)?(?:` + hostname + `|` + ipv4 + `|\[` + ipv6 + `\])(?::[0-9]{1,5})?(?:[/?#]\S*)?\z`)
+
+// IPv4 matches an IPv4 address in dotted decimal form, without leading zeros
+var IPv4 *regex.Regexp = regex.Comp(`\A` + ipv4 + `\z`)
+
+// IPv6 matches an IPv6 address, including the compressed (::) and IPv4 mapped forms
+//
+// zones (%eth0) are not supported
+var IPv6 *regex.Regexp = regex.Comp(`\A` + ipv6 + `\z`)
+
+// UUID matches an RFC 9562 UUID (versions 1 to 8), or the nil and max UUID
+var UUID *regex.Regexp = regex.Comp(`\A(?:[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[1-8][0-9A-Fa-f]{3}-[89ABab][0-9A-Fa-f]{3}-[0-9A-Fa-f]{12}|0{8}-0{4}-0{4}-0{4}-0{12}|[Ff]{8}-[Ff]{4}-[Ff]{4}-[Ff]{4}-[Ff]{12})\z`)
+
+// SemVer matches a semantic version (semver.org 2.0.0), without a v prefix
+//
+// the parts are captured by the groups named major, minor, patch, prerelease and build
+var SemVer *regex.Regexp = regex.Comp(`\A(?P<major>0|[1-9][0-9]*)\.(?P<minor>0|[1-9][0-9]*)\.(?P<patch>0|[1-9][0-9]*)` +
+	`(?:\-(?P<prerelease>(?:0|[1-9][0-9]*|[0-9]*[A-Za-z\-][0-9A-Za-z\-]*)(?:\.(?:0|[1-9][0-9]*|[0-9]*[A-Za-z\-][0-9A-Za-z\-]*))*))?` +
+	`(?:\+(?P<build>[0-9A-Za-z\-]+(?:\.[0-9A-Za-z\-]+)*))?\z`)
+
+// ISO8601 matches an ISO 8601 date (2006-01-02), with an optional time (T15:04, T15:04:05, T15:04:05.000) and time zone (Z, +07, +0700, +07:00)
+//
+// the number of days in the month is not checked (2006-02-31 is matched)
+var ISO8601 *regex.Regexp = regex.Comp(`\A[0-9]{4}\-(?:0[1-9]|1[0-2])\-(?:0[1-9]|[12][0-9]|3[01])` +
+	`(?:T(?:[01][0-9]|2[0-3]):[0-5][0-9](?::[0-5][0-9](?:[.,][0-9]+)?)?(?:Z|[+\-](?:[01][0-9]|2[0-3])(?::?[0-5][0-9])?)?)?\z`)
+
+// CreditCard matches a credit card number of 13 to 19 digits, which can be separated by spaces or hyphens
+//
+// the check digit is not verified by the regex (use IsCreditCard)
+var CreditCard *regex.Regexp = regex.Comp(`\A[0-9](?:[ \-]?[0-9]){12,18}\z`)
+
+// Hostname matches an RFC 1123 hostname
+//
+// the total length is not checked by the regex (use IsHostname)
+var Hostname *regex.Regexp = regex.Comp(`\A` + hostname + `\z`)
+
+//* helpers
+
+// IsEmail returns true if a string is an email address (see Email)
+//
+// the local part must be at most 64 bytes, and the full address must be at most 254 bytes
+func IsEmail(str string) bool {
+	if len(str) > 254 {
+		return false
+	}
+	if i := strings.LastIndexByte(str, '@'); i == -1 || i > 64 {
+		return false
+	}
+	return Email.MatchString(str)
+}
+
+// IsURL returns true if a string is a URL (see URL)
+func IsURL(str string) bool {
+	return URL.MatchString(str)
+}
+
+// IsIPv4 returns true if a string is an IPv4 address
+func IsIPv4(str string) bool {
+	return IPv4.MatchString(str)
+}
+
+// IsIPv6 returns true if a string is an IPv6 address
+func IsIPv6(str string) bool {
+	return IPv6.MatchString(str)
+}
+
+// IsIP returns true if a string is an IPv4 or IPv6 address
+func IsIP(str string) bool {
+	return IPv4.MatchString(str) || IPv6.MatchString(str)
+}
+
+// IsUUID returns true if a string is a UUID (see UUID)
+func IsUUID(str string) bool {
+	return UUID.MatchString(str)
+}
+
+// IsSemVer returns true if a string is a semantic version
+func IsSemVer(str string) bool {
+	return SemVer.MatchString(str)
+}
+
+// IsISO8601 returns true if a string is an ISO 8601 date, or date and time (see ISO8601)
+func IsISO8601(str string) bool {
+	return ISO8601.MatchString(str)
+}
+
+// IsCreditCard returns true if a string is a credit card number with a valid Luhn check digit
+func IsCreditCard(str string) bool {
+	if !CreditCard.MatchString(str) {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(str)-1; i >= 0; i-- {
+		if str[i] < '0' || str[i] > '9' {
+			continue
+		}
+
+		n := int(str[i] - '0')
+		if double {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// IsHostname returns true if a string is a hostname of at most 253 bytes
+func IsHostname(str string) bool {
+	return len(str) <= 253 && Hostname.MatchString(str)
+}
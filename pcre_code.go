@@ -0,0 +1,219 @@
+//go:build cgo && !nopcre
+
+package regex
+
+/*
+#cgo pkg-config: libpcre
+#include <stdlib.h>
+#include <pcre.h>
+
+// pcre_free is a function pointer, so it needs a wrapper to be called from go
+static void regex_pcre_free(void *p) {
+	pcre_free(p);
+}
+
+// regex_pcre_exec runs pcre_exec with a copy of the study data, so the match limit can be lowered for a single call
+// without changing the study data that other goroutines share
+static int regex_pcre_exec(const pcre *code, const pcre_extra *extra, const char *subject, int length, int offset, int options, int *ovector, int size, unsigned long limit) {
+	pcre_extra e = {0};
+	if (extra != NULL) {
+		e = *extra;
+	}
+	if (limit > 0 && (!(e.flags & PCRE_EXTRA_MATCH_LIMIT) || e.match_limit > limit)) {
+		e.flags |= PCRE_EXTRA_MATCH_LIMIT;
+		e.match_limit = limit;
+	}
+	return pcre_exec(code, &e, subject, length, offset, options, ovector, size);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// pcreCode is a regex compiled with pcre_compile
+//
+// the go-pcre module does not export its compiled regex, and it always starts a search at the start of the []byte it is given,
+// so a search that started after a previous match could not see the text before it.
+// pcreCode compiles the regex again, so the full []byte and a start offset can be passed to pcre_exec
+type pcreCode struct {
+	code *C.pcre
+	extra *C.pcre_extra
+	groups int
+	// names is the name of each capture group, with an empty name for the full match and unnamed groups
+	names []string
+	// lookbehind is the max number of chars before the start of a match that a lookbehind (or \b) can read
+	lookbehind int
+}
+
+// pcreCompile compiles a regex with pcre_compile and pcre_study
+//
+// @flags: the pcre compile options
+//
+// @study: the pcre study options (ie: to use the JIT)
+func pcreCompile(re string, flags int, study int) (*pcreCode, error) {
+	pattern := C.CString(re)
+	defer C.free(unsafe.Pointer(pattern))
+
+	var errPtr *C.char
+	var errOffset C.int
+	code := C.pcre_compile(pattern, C.int(flags), &errPtr, &errOffset, nil)
+	if code == nil {
+		return nil, fmt.Errorf("%s (%d): %s", re, int(errOffset), C.GoString(errPtr))
+	}
+
+	c := &pcreCode{code: code}
+	runtime.SetFinalizer(c, (*pcreCode).free)
+
+	var groups C.int
+	if rc := C.pcre_fullinfo(code, nil, C.PCRE_INFO_CAPTURECOUNT, unsafe.Pointer(&groups)); rc != 0 {
+		return nil, pcreExecError(int(rc))
+	}
+	c.groups = int(groups)
+
+	names, err := c.nameTable()
+	if err != nil {
+		return nil, err
+	}
+	c.names = names
+
+	var lookbehind C.int
+	if rc := C.pcre_fullinfo(code, nil, C.PCRE_INFO_MAXLOOKBEHIND, unsafe.Pointer(&lookbehind)); rc != 0 {
+		return nil, pcreExecError(int(rc))
+	}
+	c.lookbehind = int(lookbehind)
+
+	// study the regex for faster matching
+	// a nil result with no error means there was nothing to optimize
+	c.extra = C.pcre_study(code, C.int(study), &errPtr)
+	if c.extra == nil && errPtr != nil {
+		return nil, errors.New("pcre_study: " + C.GoString(errPtr))
+	}
+
+	return c, nil
+}
+
+// nameTable returns the name of each capture group from the pcre name table
+//
+// each entry of the table is the group number (2 bytes, big endian), followed by the name and a NUL byte,
+// and padded to the size of the longest entry
+func (c *pcreCode) nameTable() ([]string, error) {
+	names := make([]string, c.groups+1)
+
+	var count, size C.int
+	var table *C.uchar
+	if rc := C.pcre_fullinfo(c.code, nil, C.PCRE_INFO_NAMECOUNT, unsafe.Pointer(&count)); rc != 0 {
+		return nil, pcreExecError(int(rc))
+	}
+	if count == 0 {
+		return names, nil
+	}
+	if rc := C.pcre_fullinfo(c.code, nil, C.PCRE_INFO_NAMEENTRYSIZE, unsafe.Pointer(&size)); rc != 0 {
+		return nil, pcreExecError(int(rc))
+	}
+	if rc := C.pcre_fullinfo(c.code, nil, C.PCRE_INFO_NAMETABLE, unsafe.Pointer(&table)); rc != 0 {
+		return nil, pcreExecError(int(rc))
+	}
+
+	data := C.GoBytes(unsafe.Pointer(table), count*size)
+	for i := 0; i < int(count); i++ {
+		entry := data[i*int(size):(i+1)*int(size)]
+		group := int(entry[0])<<8 | int(entry[1])
+
+		name := entry[2:]
+		if e := bytes.IndexByte(name, 0); e != -1 {
+			name = name[:e]
+		}
+
+		// with duplicate names, more than one group can have the same name
+		if group < len(names) {
+			names[group] = string(name)
+		}
+	}
+
+	return names, nil
+}
+
+// free releases the memory pcre allocated for the compiled regex
+func (c *pcreCode) free() {
+	if c.extra != nil {
+		C.pcre_free_study(c.extra)
+		c.extra = nil
+	}
+	if c.code != nil {
+		C.regex_pcre_free(unsafe.Pointer(c.code))
+		c.code = nil
+	}
+}
+
+// exec runs pcre_exec on the full []byte, and starts the search at @offset
+//
+// the bytes before @offset can still be used by lookbehinds and \b, and ^ only matches at the start of @str.
+// a capture group that did not participate in the match has the indexes -1, -1
+//
+// @flags: the pcre exec options
+//
+// @limit: the max number of internal match calls pcre can make (0 to keep the limit the regex was compiled with).
+// a lower limit set by the regex itself is still used
+//
+// if the pcre partial flag is set, a match that reaches the end of @str before it can finish will be returned with isPartial set to true,
+// and only the start and end index of the partial match
+func (c *pcreCode) exec(str []byte, offset int, flags int, limit int) (ind []int, isPartial bool, err error) {
+	subject := str
+	if len(subject) == 0 {
+		// make the first char addressable
+		subject = []byte{0}
+	}
+
+	ovector := make([]C.int, (c.groups+1)*3)
+
+	rc := int(C.regex_pcre_exec(c.code, c.extra,
+		(*C.char)(unsafe.Pointer(&subject[0])), C.int(len(str)), C.int(offset), C.int(flags),
+		&ovector[0], C.int(len(ovector)), C.ulong(limit)))
+	runtime.KeepAlive(c)
+
+	if rc == C.PCRE_ERROR_NOMATCH {
+		return nil, false, nil
+	}else if rc == C.PCRE_ERROR_PARTIAL {
+		return []int{int(ovector[0]), int(ovector[1])}, true, nil
+	}else if rc < 0 {
+		return nil, false, pcreExecError(rc)
+	}
+
+	ind = make([]int, (c.groups+1)*2)
+	for i := range ind {
+		ind[i] = int(ovector[i])
+	}
+
+	// groups after the last one that participated are not set by pcre_exec
+	for i := rc*2; i < len(ind); i++ {
+		ind[i] = -1
+	}
+
+	return ind, false, nil
+}
+
+// pcreExecError converts an error code from pcre into an error, with the same messages as the go-pcre module
+func pcreExecError(rc int) error {
+	msg := "unexpected return code"
+	switch rc {
+	case C.PCRE_ERROR_NOMEMORY:
+		msg = "match limit"
+	case C.PCRE_ERROR_MATCHLIMIT:
+		msg = "backtracking (match) limit was reached"
+	case C.PCRE_ERROR_RECURSIONLIMIT:
+		msg = "recursion limit"
+	case C.PCRE_ERROR_BADUTF8:
+		msg = "string that contains an invalid UTF-8 byte sequence was passed as a subject"
+	case C.PCRE_ERROR_BADUTF8_OFFSET:
+		msg = "the start offset is not at the start of a UTF-8 char"
+	case C.PCRE_ERROR_JIT_STACKLIMIT:
+		msg = "error JIT stack limit"
+	}
+	return fmt.Errorf("%d, pcre_exec: %s", rc, msg)
+}
@@ -2,44 +2,49 @@ package regex
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/AspieSoft/go-regex/v8/common"
-	"github.com/GRbit/go-pcre"
 )
 
-type PCRE pcre.Regexp
 type RE2 *regexp.Regexp
 
 type Regexp struct {
-	RE pcre.Regexp
+	RE Engine
 	len int64
+	names []string
+	engine engineData
 }
 
-type bgPart struct {
-	ref []byte
-	b []byte
-}
+var regCompCommentAndChars *regexp.Regexp = regexp.MustCompile(`(\\|)\(\?#.*?\)|\\[\\']`)
+var regCompParam *regexp.Regexp = regexp.MustCompile(`(\\|)%(\{[0-9]+(?::(?:raw|list|class))?\}|[0-9]|\{[A-Za-z_][A-Za-z0-9_]*(?::(?:raw|list|class))?\})`)
+
+// ErrMissingParam is returned by CompNamedTry when a param in the regex has no value
+var ErrMissingParam error = errors.New("regex: missing value for param")
 
-var regCompCommentAndChars *regexp.Regexp = regexp.MustCompile(`(\\|)\(\?#.*?\)|%!|!%|\\[\\']`)
-var regCompParam *regexp.Regexp = regexp.MustCompile(`(\\|)%(\{[0-9]+\}|[0-9])`)
-var regCompBG *regexp.Regexp = regexp.MustCompile(`\[^?(\\[\\\]]|[^\]])+\]`)
-var regCompBGRefChar *regexp.Regexp = regexp.MustCompile(`%!|!%`)
-var regCompBGRef *regexp.Regexp = regexp.MustCompile(`%!([0-9]+|o|c)!%`)
+// ErrClassSet is returned by CompTry when a [...] class has a set operation (like [a-z--[aeiou]]) that cannot be expanded
+var ErrClassSet error = errors.New("regex: cannot expand class set operation")
+
+// ErrPCREOnly is returned when a regex uses syntax that only pcre supports,
+// and the module was built with the nopcre tag (or without cgo)
+var ErrPCREOnly error = errors.New("regex: syntax is only supported by pcre")
 
 var regComplexSel *Regexp
 var regEscape *Regexp
 
-var cache common.CacheMap[*Regexp] = common.NewCache[*Regexp]()
-var compCache common.CacheMap[[]byte] = common.NewCache[[]byte]()
 
 func init() {
-	regComplexSel = Comp(`(\\|)\$([0-9]|\{[0-9]+\})`)
+	regComplexSel = Comp(`(\\|)\$([0-9]|\{[0-9]+\}|\{[A-Za-z_][A-Za-z0-9_]*\})`)
 	regEscape = Comp(`[\\\^\$\.\|\?\*\+\(\)\[\]\{\}\%]`)
 
 	go func(){
@@ -71,14 +76,18 @@ func init() {
 				cacheTime = 3 * time.Hour
 			}
 
-			cache.DelOld(cacheTime)
+			if c, ok := getCache().(interface{ DelOld(time.Duration) }); ok {
+				c.DelOld(cacheTime)
+			}
 			compCache.DelOld(cacheTime)
 
 			time.Sleep(10 * time.Second)
 
 			// clear cache if were still critically low on available memory
 			if mb := common.SysFreeMemory(); mb < 10 && mb != 0 {
-				cache.DelOld(0)
+				if c, ok := getCache().(interface{ DelOld(time.Duration) }); ok {
+					c.DelOld(0)
+				}
 				compCache.DelOld(0)
 			}
 		}
@@ -87,33 +96,93 @@ func init() {
 
 // this method compiles the RE string to add more functionality to it
 func compRE(re string, params []string) string {
-	if val, err := compCache.Get(re); val != nil || err != nil {
-		if err != nil {
-			return ""
-		}
+	res, _ := compRENamed(re, params, nil)
+	return res
+}
 
-		return string(regCompParam.ReplaceAllFunc(val, func(b []byte) []byte {
-			if b[1] == '{' && b[len(b)-1] == '}' {
-				b = b[2:len(b)-1]
-			}else{
-				b = b[1:]
-			}
-	
-			if n, e := strconv.Atoi(string(b)); e == nil && n > 0 && n <= len(params) {
-				return []byte(Escape(params[n-1]))
+// compRENamed is the same as compRE, but also replaces named params (%{name})
+//
+// if @named is nil, named params are left unchanged, and positional params without a value are removed.
+// otherwise, every param must have a value, or a *CompileError is returned
+//
+// a *CompileError is also returned if a class has a set operation that cannot be expanded (like a class with a param)
+func compRENamed(re string, params []string, named map[string]string) (string, error) {
+	key := re + getSyntaxKey() + getDefKey(named)
+	val, err := compCache.Get(key)
+	compREStats.count(val != nil, err)
+	if err != nil {
+		return "", err
+	}
+
+	if val == nil {
+		var classSet int
+		val, _, classSet = compREParse(re, nil, named)
+		if classSet != -1 {
+			// the class is left as it is, which the engine would read as a different class
+			return "", &CompileError{
+				Message: "cannot expand class set operation",
+				Offset: parseOffset(re, named, classSet),
+				Pattern: re,
+				ExpandedOffset: -1,
+				Err: ErrClassSet,
 			}
-			return []byte{}
-		}))
-	}
-	
-	reB := []byte(re)
-
-	reB = regCompCommentAndChars.ReplaceAllFunc(reB, func(b []byte) []byte {
-		if bytes.Equal(b, []byte("%!")) {
-			return []byte("%!o!%")
-		}else if bytes.Equal(b, []byte("!%")) {
-			return []byte("%!c!%")
-		}else if b[0] == '\\' {
+		}
+		compCache.Set(key, val, nil)
+	}
+
+	res, _, missing := compREParams(val, nil, params, named)
+	if missing != -1 {
+		param := regCompParam.Find(val[missing:])
+		return "", &CompileError{
+			Message: "missing value for param " + string(param),
+			Offset: parseOffset(re, named, missing),
+			Pattern: re,
+			ExpandedOffset: -1,
+			Err: ErrMissingParam,
+		}
+	}
+
+	return string(res), nil
+}
+
+// parseOffset returns the offset in @re of the byte at index @i of the regex returned by compREParse
+func parseOffset(re string, named map[string]string, i int) int {
+	srcMap := make([]int, len(re)+1)
+	for j := range srcMap {
+		srcMap[j] = j
+	}
+	_, srcMap, _ = compREParse(re, srcMap, named)
+	return srcMap[i]
+}
+
+// compREMap runs compRE without the cache, and returns a map of each byte in the result to its offset in @re
+//
+// the map has one extra value at the end, for the offset of the end of the pattern
+func compREMap(re string, params []string, named map[string]string) []int {
+	srcMap := make([]int, len(re)+1)
+	for i := range srcMap {
+		srcMap[i] = i
+	}
+
+	reB, srcMap, _ := compREParse(re, srcMap, named)
+	_, srcMap, _ = compREParams(reB, srcMap, params, named)
+	return srcMap
+}
+
+// compREParse runs the part of compRE that does not depend on the params
+//
+// the steps run in this order: defined patterns (%{NAME}), comments and \', tokens added by RegisterSyntax, then [...] classes
+//
+// @srcMap: if not nil, a map of the offsets is kept in the same way as mappedReplace
+//
+// @named: defined patterns with the same name as a named param are not expanded (see expandDefs)
+//
+// the index of the first class with a set operation that could not be expanded is returned, or -1 if there was none
+func compREParse(re string, srcMap []int, named map[string]string) ([]byte, []int, int) {
+	reB, srcMap := expandDefs([]byte(re), srcMap, named)
+
+	reB, srcMap = mappedReplace(regCompCommentAndChars, reB, srcMap, func(b []byte) []byte {
+		if b[0] == '\\' {
 			if b[1] == '\'' {
 				return []byte{'`'}
 			}
@@ -122,154 +191,389 @@ func compRE(re string, params []string) string {
 		return []byte{}
 	})
 
-	bgList := [][]byte{}
-	reB = regCompBG.ReplaceAllFunc(reB, func(b []byte) []byte {
-		bgList = append(bgList, b)
-		return common.JoinBytes('%', '!', len(bgList)-1, '!', '%')
+	reB, srcMap = expandSyntax(reB, srcMap)
+
+	classSet := -1
+	classes := findClasses(reB)
+	i, diff := 0, 0
+	reB, srcMap = mappedReplaceIndex(reB, srcMap, classes, func(b []byte) []byte {
+		pos := classes[i][0] + diff
+		i++
+
+		res, ok := expandClassSet(b)
+		if !ok {
+			if classSet == -1 && hasSetOp(b) {
+				classSet = pos
+			}
+
+			if len(b) > 2 && b[1] == '^' {
+				res = append(append([]byte("[^"), sortClass(b[2:len(b)-1])...), ']')
+			}else{
+				res = append(append([]byte{'['}, sortClass(b[1:len(b)-1])...), ']')
+			}
+		}
+
+		diff += len(res) - len(b)
+		return res
 	})
 
-	for ind, bgItem := range bgList {
-		charS := []byte{'['}
-		if bgItem[1] == '^' {
-			bgItem = bgItem[2:len(bgItem)-1]
-			charS = append(charS, '^')
-		}else{
-			bgItem = bgItem[1:len(bgItem)-1]
-		}
-
-		newBG := []bgPart{}
-		for i := 0; i < len(bgItem); i++ {
-			if i+1 < len(bgItem) {
-				if bgItem[i] == '\\' {
-					newBG = append(newBG, bgPart{ref: []byte{bgItem[i+1]}, b: []byte{bgItem[i], bgItem[i+1]}})
-					i++
-					continue
-				}else if bgItem[i+1] == '-' && i+2 < len(bgItem) {
-					newBG = append(newBG, bgPart{ref: []byte{bgItem[i], bgItem[i+2]}, b: []byte{bgItem[i], bgItem[i+1], bgItem[i+2]}})
-					i += 2
-					continue
-				}
+	return reB, srcMap, classSet
+}
+
+// compREParams replaces the params in a regex that has already been through compREParse
+//
+// @srcMap: if not nil, a map of the offsets is kept in the same way as mappedReplace
+//
+// @named: the values of named params (see compRENamed)
+//
+// the index of the first param without a value is returned, or -1 if every param had a value (this is only checked if @named is not nil)
+func compREParams(reB []byte, srcMap []int, params []string, named map[string]string) ([]byte, []int, int) {
+	missing := -1
+	ind := paramIndex(reB)
+	i := 0
+
+	res, resMap := mappedReplaceIndex(reB, srcMap, ind, func(b []byte) []byte {
+		pos := ind[i][0]
+		i++
+
+		// escaped params are not replaced
+		if b[0] == '\\' {
+			return b
+		}
+
+		// a class param that is the only part of a class (like [%{1:class}]) is replaced with the class
+		src := b
+		class := ""
+		if b[0] == '[' {
+			class = "["
+			if b[1] == '^' {
+				class = "[^"
+			}
+			b = b[len(class):len(b)-1]
+			pos += len(class)
+		}
+
+		mod := ""
+		if b[1] == '{' && b[len(b)-1] == '}' {
+			b = b[2:len(b)-1]
+			if j := bytes.IndexByte(b, ':'); j != -1 {
+				mod = string(b[j+1:])
+				b = b[:j]
 			}
-			newBG = append(newBG, bgPart{ref: []byte{bgItem[i]}, b: []byte{bgItem[i]}})
+		}else{
+			b = b[1:]
 		}
 
-		sort.Slice(newBG, func(i, j int) bool {
-			if len(newBG[i].ref) > len(newBG[j].ref) {
-				return true
-			}else if len(newBG[i].ref) < len(newBG[j].ref) {
-				return false
+		val, ok := "", false
+		if n, e := strconv.Atoi(string(b)); e == nil {
+			if n > 0 && n <= len(params) {
+				val, ok = params[n-1], true
 			}
+		}else if named == nil {
+			return src
+		}else{
+			val, ok = named[string(b)]
+		}
 
-			for k := 0; k < len(newBG[i].ref); k++ {
-				if newBG[i].ref[k] < newBG[j].ref[k] {
-					return true
-				}else if newBG[i].ref[k] > newBG[j].ref[k] {
-					return false
-				}
+		if !ok {
+			if named != nil && missing == -1 {
+				missing = pos
+			}
+			if class == "" {
+				return []byte{}
 			}
+		}
 
-			return false
-		})
+		val = formatParam(val, mod)
+		if class == "" {
+			return []byte(val)
+		}
 
-		bgItem = charS
-		for i := 0; i < len(newBG); i++ {
-			bgItem = append(bgItem, newBG[i].b...)
+		// an empty class would change the meaning of the ] after it, so a class that matches nothing (or anything if it is negated) is used
+		if val == "" {
+			if class == "[^" {
+				return []byte(classAny)
+			}
+			return []byte(classNone)
 		}
-		bgItem = append(bgItem, ']')
+		return []byte(class + val + "]")
+	})
+
+	return res, resMap, missing
+}
 
-		bgList[ind] = bgItem
+// paramIndex returns the start and end of each param in a regex
+//
+// a class param that is the only part of a class (like [%{1:class}] or [^%{1:class}]) includes the brackets of the class
+func paramIndex(reB []byte) [][]int {
+	ind := regCompParam.FindAllIndex(reB, -1)
+	if len(ind) == 0 {
+		return ind
 	}
 
-	reB = regCompBGRef.ReplaceAllFunc(reB, func(b []byte) []byte {
-		b = b[2:len(b)-2]
+	classes := map[int]int{}
+	for _, pos := range findClasses(reB) {
+		classes[pos[1]] = pos[0]
+	}
 
-		if b[0] == 'o' {
-			return []byte(`%!`)
-		}else if b[0] == 'c' {
-			return []byte(`!%`)
+	for _, pos := range ind {
+		if reB[pos[0]] == '\\' || !bytes.HasSuffix(reB[pos[0]:pos[1]], []byte(":class}")) {
+			continue
 		}
 
-		if n, e := strconv.Atoi(string(b)); e == nil && n < len(bgList) {
-			return bgList[n]
+		start, ok := classes[pos[1]+1]
+		if !ok {
+			continue
 		}
-		return []byte{}
-	})
+		if start == pos[0]-1 || (start == pos[0]-2 && reB[start+1] == '^') {
+			pos[0], pos[1] = start, pos[1]+1
+		}
+	}
 
-	compCache.Set(re, reB, nil)
+	return ind
+}
 
-	return string(regCompParam.ReplaceAllFunc(reB, func(b []byte) []byte {
-		if b[1] == '{' && b[len(b)-1] == '}' {
-			b = b[2:len(b)-1]
-		}else{
-			b = b[1:]
+// classNone is a class that never matches
+const classNone = `[^\x00-\x{10FFFF}]`
+
+// classAny is a class that matches any char
+const classAny = `[\x00-\x{10FFFF}]`
+
+// paramListSep separates the values of a list made by ParamList
+//
+// only the list modifier splits a param on it, so a NUL byte in any other param is matched as it is
+const paramListSep = "\x00"
+
+// formatParam formats the value of a param for its modifier
+//
+// a NUL byte is replaced with \x00 (even in a raw param), since a pcre pattern cannot contain one
+//
+// @mod: "" (escaped), "raw", "list", or "class"
+func formatParam(val string, mod string) string {
+	switch mod {
+	case "raw":
+		return escapeNUL(val)
+	case "list":
+		list := strings.Split(val, paramListSep)
+		if len(list) == 1 && list[0] == "" {
+			// an empty list never matches
+			return classNone
+		}
+		for i := range list {
+			list[i] = escapeNUL(Escape(list[i]))
 		}
+		return "(?:" + strings.Join(list, "|") + ")"
+	case "class":
+		return escapeNUL(escapeClass(val))
+	}
+	return escapeNUL(Escape(val))
+}
+
+// escapeNUL replaces the NUL bytes in a param with \x00
+func escapeNUL(val string) string {
+	return strings.ReplaceAll(val, "\x00", `\x00`)
+}
 
-		if n, e := strconv.Atoi(string(b)); e == nil && n > 0 && n <= len(params) {
-			return []byte(Escape(params[n-1]))
+// escapeClass escapes a string for use inside a [...] character class
+func escapeClass(val string) string {
+	res := make([]byte, 0, len(val))
+	for i := 0; i < len(val); i++ {
+		switch val[i] {
+		case '\\', ']', '[', '^', '-':
+			res = append(res, '\\')
 		}
-		return []byte{}
-	}))
+		res = append(res, val[i])
+	}
+	return string(res)
+}
+
+// mappedReplace works like ReplaceAllFunc, but also updates a map of each byte in @src to its offset in the original regex
+//
+// bytes that were replaced with a value of the same length keep their own offsets,
+// and other replacements use the offset of the start of the match.
+// if @srcMap is nil, no map is made
+func mappedReplace(re *regexp.Regexp, src []byte, srcMap []int, fn func(b []byte) []byte) ([]byte, []int) {
+	if srcMap == nil {
+		return re.ReplaceAllFunc(src, fn), nil
+	}
+	return mappedReplaceIndex(src, srcMap, re.FindAllIndex(src, -1), fn)
+}
+
+// mappedReplaceIndex is the same as mappedReplace, but replaces a list of indexes in place of the matches of a regex
+//
+// @ind: the start and end of each part of @src to replace, in order
+func mappedReplaceIndex(src []byte, srcMap []int, ind [][]int, fn func(b []byte) []byte) ([]byte, []int) {
+	res := []byte{}
+	var resMap []int
+	if srcMap != nil {
+		resMap = []int{}
+	}
+
+	last := 0
+	for _, pos := range ind {
+		res = append(res, src[last:pos[0]]...)
+		b := fn(src[pos[0]:pos[1]])
+		res = append(res, b...)
+
+		if srcMap != nil {
+			resMap = append(resMap, srcMap[last:pos[0]]...)
+			if len(b) == pos[1]-pos[0] {
+				resMap = append(resMap, srcMap[pos[0]:pos[1]]...)
+			}else{
+				for range b {
+					resMap = append(resMap, srcMap[pos[0]])
+				}
+			}
+		}
+
+		last = pos[1]
+	}
+
+	res = append(res, src[last:]...)
+	if srcMap != nil {
+		resMap = append(resMap, srcMap[last:]...)
+	}
+
+	return res, resMap
 }
 
 
 //* regex compile methods
 
 // Comp compiles a regular expression and store it in the cache
+//
+// params are escaped by default, and a modifier can change this:
+//   - %{1:list} matches any value of a list made by ParamList
+//   - %{1:class} escapes the param for use inside a [...] class (a class with only an empty class param never matches)
+//   - %{1:raw} is not escaped (only use this for trusted input)
 func Comp(re string, params ...string) *Regexp {
-	re = compRE(re, params)
+	return CompOpts(re, Options{}, params...)
+}
 
-	if val, err := cache.Get(re); val != nil || err != nil {
-		if err != nil {
-			panic(err)
-		}
+// CompTry tries to compile or returns an error
+//
+// if the regex fails to compile, the error is a *CompileError
+func CompTry(re string, params ...string) (*Regexp, error) {
+	return CompOptsTry(re, Options{}, params...)
+}
 
-		return val
+// CompOpts compiles a regular expression with extra compile options, and store it in the cache
+//
+// the options are part of the cache key, so the same regex can be cached with different options
+func CompOpts(re string, opts Options, params ...string) *Regexp {
+	reg, err := CompOptsTry(re, opts, params...)
+	if err != nil {
+		panic(err)
 	}
+	return reg
+}
 
-	reg := pcre.MustCompile(re, pcre.UTF8)
+// CompOptsTry tries to compile with extra compile options or returns an error
+//
+// if the regex fails to compile, the error is a *CompileError
+func CompOptsTry(re string, opts Options, params ...string) (*Regexp, error) {
+	expanded, err := compRENamed(re, params, nil)
+	if err != nil {
+		return &Regexp{}, err
+	}
+	return compTry(re, expanded, opts, params, nil)
+}
 
-	// commented below methods compiled 10000 times in 0.1s (above method being used finished in half of that time)
-	// reg := pcre.MustCompileParse(re)
-	// reg := pcre.MustCompileJIT(re, pcre.UTF8, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileJIT(re, pcre.EXTRA, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileJIT(re, pcre.JAVASCRIPT_COMPAT, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileParseJIT(re, pcre.STUDY_JIT_COMPILE)
+// CompNamed compiles a regular expression with named params, and store it in the cache
+//
+// use %{name} to reference a param by its name (the values are escaped in the same way as Comp,
+// and the same modifiers can be used, like %{name:list})
+//
+// a param takes precedence over a pattern added by Define with the same name
+//
+// this method will panic if a param in the regex has no value
+func CompNamed(re string, params map[string]string) *Regexp {
+	reg, err := CompNamedTry(re, params)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
 
-	compRe := Regexp{RE: reg, len: int64(len(re))}
+// CompNamedTry tries to compile a regular expression with named params or returns an error
+//
+// if a param in the regex has no value, a *CompileError that matches ErrMissingParam (with errors.Is) is returned
+func CompNamedTry(re string, params map[string]string) (*Regexp, error) {
+	if params == nil {
+		params = map[string]string{}
+	}
 
-	cache.Set(re, &compRe, nil)
-	return &compRe
+	expanded, err := compRENamed(re, nil, params)
+	if err != nil {
+		return &Regexp{}, err
+	}
+	return compTry(re, expanded, Options{}, nil, params)
 }
 
-// CompTry tries to compile or returns an error
-func CompTry(re string, params ...string) (*Regexp, error) {
-	re = compRE(re, params)
+// CompRaw compiles a regular expression without the extended syntax of Comp, and store it in the cache
+//
+// the regex is sent to the regex engine as it is, so %1, \' and (?#comments) keep the meaning the engine gives them,
+// and [...] classes are not changed
+//
+// raw regex are cached separately, so a raw and an extended regex with the same text never share a cache entry
+func CompRaw(re string) *Regexp {
+	reg, err := CompRawTry(re)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
 
-	if val, err := cache.Get(re); val != nil || err != nil {
+// CompRawTry tries to compile a regular expression without the extended syntax of Comp or returns an error
+//
+// if the regex fails to compile, the error is a *CompileError
+func CompRawTry(re string) (*Regexp, error) {
+	return compCached(rawCacheKey+re, re, Options{}, func(err error) error {
+		return rawCompileError(err, re)
+	})
+}
+
+// rawCacheKey is the prefix of the cache key of the regex compiled by CompRaw
+//
+// a NUL byte is not valid in a pcre pattern, so this will not collide with a regex compiled by Comp
+const rawCacheKey = "\x00raw\x00"
+
+// compTry compiles a regex that has already been expanded by compRE, or gets it from the cache
+//
+// @src: the original regex, which is used by compile errors
+func compTry(src string, re string, opts Options, params []string, named map[string]string) (*Regexp, error) {
+	return compCached(re+opts.key(), re, opts, func(err error) error {
+		return compileError(err, src, params, named, re)
+	})
+}
+
+// compCached compiles a regex, or gets it from the cache
+//
+// @key: the cache key of the regex
+//
+// @onErr: converts an error from the regex engine into the error that is returned (this runs on every call, so it is not cached)
+func compCached(key string, re string, opts Options, onErr func(error) error) (*Regexp, error) {
+	cache := getCache()
+	val, err := cache.Get(key)
+	compStats.count(val != nil, err)
+	if val != nil || err != nil {
 		if err != nil {
-			return &Regexp{}, err
+			return &Regexp{}, onErr(err)
 		}
 
 		return val, nil
 	}
 
-	reg, err := pcre.Compile(re, pcre.UTF8)
+	compRe, err := compile(re, opts)
 	if err != nil {
-		cache.Set(re, nil, err)
-		return &Regexp{}, err
+		// the error from the engine is cached, since many patterns can expand to the same regex,
+		// and each of them needs its own offset and pattern in the *CompileError
+		cache.Set(key, nil, err)
+		return &Regexp{}, onErr(err)
 	}
 
-	// commented below methods compiled 10000 times in 0.1s (above method being used finished in half of that time)
-	// reg := pcre.MustCompileParse(re)
-	// reg := pcre.MustCompileJIT(re, pcre.UTF8, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileJIT(re, pcre.EXTRA, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileJIT(re, pcre.JAVASCRIPT_COMPAT, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileParseJIT(re, pcre.STUDY_JIT_COMPILE)
-
-	compRe := Regexp{RE: reg, len: int64(len(re))}
-
-	cache.Set(re, &compRe, nil)
-	return &compRe, nil
+	cache.Set(key, compRe, nil)
+	return compRe, nil
 }
 
 
@@ -279,69 +583,73 @@ func CompTry(re string, params ...string) (*Regexp, error) {
 //
 // similar to JavaScript .replace(/re/, function(data){})
 func (reg *Regexp) RepFunc(str []byte, rep func(data func(int) []byte) []byte, blank ...bool) []byte {
-	ind := reg.RE.FindAllIndex(str, 0)
+	res, _ := reg.repFunc(context.Background(), str, func(ind []int) []byte {
+		return rep(groupData(str, ind))
+	}, len(blank) != 0)
+	return res
+}
 
+// RepFuncNamed is the same as RepFunc, but also gives the callback access to named capture groups
+//
+// named capture groups are written as (?<name>re), (?'name're) or (?P<name>re)
+func (reg *Regexp) RepFuncNamed(str []byte, rep func(data func(int) []byte, named func(string) []byte) []byte, blank ...bool) []byte {
+	res, _ := reg.repFunc(context.Background(), str, func(ind []int) []byte {
+		data := groupData(str, ind)
+		return rep(data, func(name string) []byte {
+			return data(reg.SubexpIndex(name))
+		})
+	}, len(blank) != 0)
+	return res
+}
+
+// repFunc replaces each match with the result of a function that receives the group indexes of the match
+//
+// if the function returns nil, the current match is removed and the loop stops early
+//
+// @blank: if true, the function is only called for each match, and an empty []byte is returned
+func (reg *Regexp) repFunc(ctx context.Context, str []byte, rep func(ind []int) []byte, blank bool) ([]byte, error) {
 	res := []byte{}
 	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.NewMatcher(v, 0)
-
-		if len(blank) != 0 {
-			gCache := map[int][]byte{}
-			r := rep(func(g int) []byte {
-				if v, ok := gCache[g]; ok {
-					return v
-				}
-				v := m.Group(g)
-				gCache[g] = v
-				return v
-			})
-
-			if []byte(r) == nil {
-				return []byte{}
-			}
-		} else {
-			if trim == 0 {
-				res = append(res, str[:pos[0]]...)
-			} else {
-				res = append(res, str[trim:pos[0]]...)
-			}
-			trim = pos[1]
+	err := reg.eachContext(ctx, str, func(ind []int) bool {
+		if blank {
+			return rep(ind) != nil
+		}
 
-			gCache := map[int][]byte{}
-			r := rep(func(g int) []byte {
-				if v, ok := gCache[g]; ok {
-					return v
-				}
-				v := m.Group(g)
-				gCache[g] = v
-				return v
-			})
-
-			if []byte(r) == nil {
-				res = append(res, str[trim:]...)
-				return res
-			}
+		res = append(res, str[trim:ind[0]]...)
+		trim = ind[1]
 
-			res = append(res, r...)
+		r := rep(ind)
+		if r == nil {
+			return false
 		}
+
+		res = append(res, r...)
+		return true
+	})
+
+	if err != nil {
+		return str, err
 	}
 
-	if len(blank) != 0 {
-		return []byte{}
+	if blank {
+		return []byte{}, nil
 	}
 
 	res = append(res, str[trim:]...)
 
-	return res
+	return res, nil
 }
 
-// RepStrLit replaces a string with another string
+// groupData returns a function that returns the value of a capture group from a list of group indexes
 //
-// note: this function is optimized for performance, and the replacement string does not accept replacements like $1
-func (reg *Regexp) RepStrLit(str []byte, rep []byte) []byte {
-	return reg.RE.ReplaceAll(str, rep, 0)
+// groups that do not exist or did not participate in the match return nil
+func groupData(str []byte, ind []int) func(int) []byte {
+	return func(g int) []byte {
+		if g < 0 || g*2+1 >= len(ind) || ind[g*2] < 0 {
+			return nil
+		}
+		return str[ind[g*2]:ind[g*2+1]]
+	}
 }
 
 // RepStr is a more complex version of the RepStrLit method
@@ -351,86 +659,277 @@ func (reg *Regexp) RepStrLit(str []byte, rep []byte) []byte {
 // use $0 to use the full regex capture group
 //
 // use ${123} to use numbers with more than one digit
+//
+// use ${name} to use a named capture group
 func (reg *Regexp) RepStr(str []byte, rep []byte) []byte {
-	ind := reg.RE.FindAllIndex(str, 0)
+	res, _ := reg.repFunc(context.Background(), str, func(ind []int) []byte {
+		return reg.expand(rep, groupData(str, ind))
+	}, false)
+	return res
+}
 
-	res := []byte{}
+// expand replaces things in a template like $1 and ${name} with the value of a capture group
+func (reg *Regexp) expand(rep []byte, group func(int) []byte) []byte {
+	return regComplexSel.RepFunc(rep, func(data func(int) []byte) []byte {
+		if len(data(1)) != 0 {
+			return data(0)
+		}
+		n := data(2)
+		if len(n) > 1 {
+			n = n[1:len(n)-1]
+		}
+		if i, err := strconv.Atoi(string(n)); err == nil {
+			return group(i)
+		}
+		if i := reg.SubexpIndex(string(n)); i != -1 {
+			return group(i)
+		}
+		return []byte{}
+	})
+}
+
+// Split splits a string, and keeps capture groups
+//
+// Similar to JavaScript .split(/re/)
+func (reg *Regexp) Split(str []byte) [][]byte {
+	res, _ := reg.split(context.Background(), str)
+	return res
+}
+
+// split splits a string, and keeps capture groups
+func (reg *Regexp) split(ctx context.Context, str []byte) ([][]byte, error) {
+	ind, err := reg.splitIndex(ctx, str)
+	if err != nil {
+		return nil, err
+	}
+	return matchValues(str, ind), nil
+}
+
+// splitIndex returns the start and end index of each part of a split string, including the kept capture groups
+func (reg *Regexp) splitIndex(ctx context.Context, str []byte) ([][]int, error) {
+	res := [][]int{}
 	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.NewMatcher(v, 0)
+	err := reg.eachContext(ctx, str, func(ind []int) bool {
+		res = append(res, []int{trim, ind[0]})
+		trim = ind[1]
 
-		if trim == 0 {
-			res = append(res, str[:pos[0]]...)
-		} else {
-			res = append(res, str[trim:pos[0]]...)
+		for i := 2; i+1 < len(ind); i += 2 {
+			if ind[i] >= 0 && ind[i] != ind[i+1] {
+				res = append(res, ind[i:i+2])
+			}
 		}
-		trim = pos[1]
+		return true
+	})
 
-		r := regComplexSel.RepFunc(rep, func(data func(int) []byte) []byte {
-			if len(data(1)) != 0 {
-				return data(0)
-			}
-			n := data(2)
-			if len(n) > 1 {
-				n = n[1:len(n)-1]
-			}
-			if i, err := strconv.Atoi(string(n)); err == nil {
-				return m.Group(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if trim < len(str) {
+		res = append(res, []int{trim, len(str)})
+	}
+
+	return res, nil
+}
+
+// SubexpNames returns the names of the capture groups in the regex
+//
+// index 0 is the full match, and unnamed capture groups have an empty name
+func (reg *Regexp) SubexpNames() []string {
+	return append([]string{}, reg.names...)
+}
+
+// SubexpIndex returns the index of the first capture group with a given name, or -1 if there is no group with that name
+func (reg *Regexp) SubexpIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+
+	for i, n := range reg.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+//* regex find methods
+
+// each runs a callback with the group indexes of every match in a []byte
+//
+// the indexes are absolute to @str, and a capture group that did not participate has the indexes -1, -1
+//
+// if the callback returns false, the loop will stop early
+func (reg *Regexp) each(str []byte, cb func(ind []int) bool) error {
+	offset := 0
+	lastEnd := -1
+	for offset <= len(str) {
+		// only the first search needs to check @str for invalid utf8
+		ind, _, err := reg.match(str, offset, false, offset != 0)
+		if err != nil || ind == nil {
+			return err
+		}
+
+		// empty matches directly after a previous match are ignored
+		if ind[0] != ind[1] || ind[0] != lastEnd {
+			if !cb(ind) {
+				return nil
 			}
-			return []byte{}
-		})
+		}
+		lastEnd = ind[1]
 
-		if r == nil {
-			res = append(res, str[trim:]...)
-			return res
+		offset = nextOffset(str, ind)
+	}
+
+	return nil
+}
+
+// shiftIndex adds an offset to every group index that participated in a match
+func shiftIndex(ind []int, offset int) {
+	for i := range ind {
+		if ind[i] >= 0 {
+			ind[i] += offset
 		}
+	}
+}
 
-		res = append(res, r...)
+// nextOffset returns the index to search for the next match from
+//
+// after an empty match, the offset is moved forward by 1 utf8 char so the loop can continue
+func nextOffset(str []byte, ind []int) int {
+	if ind[0] != ind[1] {
+		return ind[1]
+	}
+	if ind[1] >= len(str) {
+		return len(str)+1
 	}
+	_, size := utf8.DecodeRune(str[ind[1]:])
+	return ind[1] + size
+}
 
-	res = append(res, str[trim:]...)
+// FindIndex returns the start and end index of the first match, or nil if there is no match
+func (reg *Regexp) FindIndex(str []byte) []int {
+	var res []int
+	reg.each(str, func(ind []int) bool {
+		res = ind[:2]
+		return false
+	})
+	return res
+}
 
+// Find returns the first match of the regex, or nil if there is no match
+func (reg *Regexp) Find(str []byte) []byte {
+	if pos := reg.FindIndex(str); pos != nil {
+		return str[pos[0]:pos[1]:pos[1]]
+	}
+	return nil
+}
+
+// FindSubmatchIndex returns the index pairs of the first match and its capture groups, or nil if there is no match
+//
+// a capture group that did not participate in the match has the indexes -1, -1
+func (reg *Regexp) FindSubmatchIndex(str []byte) []int {
+	var res []int
+	reg.each(str, func(ind []int) bool {
+		res = ind
+		return false
+	})
 	return res
 }
 
-// Match returns true if a []byte matches a regex
-func (reg *Regexp) Match(str []byte) bool {
-	return reg.RE.MatchWFlags(str, 0)
+// FindSubmatch returns the first match and its capture groups, or nil if there is no match
+//
+// index 0 is the full match, and index 1 is the first capture group
+func (reg *Regexp) FindSubmatch(str []byte) [][]byte {
+	if ind := reg.FindSubmatchIndex(str); ind != nil {
+		return subMatches(str, ind)
+	}
+	return nil
 }
 
-// Split splits a string, and keeps capture groups
+// FindAllIndex returns the start and end index of every match
 //
-// Similar to JavaScript .split(/re/)
-func (reg *Regexp) Split(str []byte) [][]byte {
-	ind := reg.RE.FindAllIndex(str, 0)
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllIndex(str []byte, n int) [][]int {
+	res, _ := reg.findAll(context.Background(), str, n, false)
+	return res
+}
 
-	res := [][]byte{}
-	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.NewMatcher(v, 0)
+// FindAll returns every match of the regex
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAll(str []byte, n int) [][]byte {
+	return matchValues(str, reg.FindAllIndex(str, n))
+}
 
-		if trim == 0 {
-			res = append(res, str[:pos[0]])
-		} else {
-			res = append(res, str[trim:pos[0]])
-		}
-		trim = pos[1]
+// FindAllSubmatchIndex returns the index pairs of every match and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllSubmatchIndex(str []byte, n int) [][]int {
+	res, _ := reg.findAll(context.Background(), str, n, true)
+	return res
+}
 
-		for i := 1; i <= m.Groups; i++ {
-			g := m.Group(i)
-			if len(g) != 0 {
-				res = append(res, m.Group(i))
-			}
+// FindAllSubmatch returns every match of the regex and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllSubmatch(str []byte, n int) [][][]byte {
+	return subMatchValues(str, reg.FindAllSubmatchIndex(str, n))
+}
+
+// findAll returns the indexes of up to @n matches
+//
+// @submatch: if true, the indexes of the capture groups are included
+func (reg *Regexp) findAll(ctx context.Context, str []byte, n int, submatch bool) ([][]int, error) {
+	if n == 0 {
+		return nil, nil
+	}
+
+	var res [][]int
+	err := reg.eachContext(ctx, str, func(ind []int) bool {
+		if !submatch {
+			ind = ind[:2]
 		}
+		res = append(res, ind)
+		return n < 0 || len(res) < n
+	})
+	return res, err
+}
+
+// matchValues converts a list of match indexes into a list of []byte values
+func matchValues(str []byte, ind [][]int) [][]byte {
+	if ind == nil {
+		return nil
+	}
+
+	res := make([][]byte, len(ind))
+	for i, pos := range ind {
+		res[i] = str[pos[0]:pos[1]:pos[1]]
+	}
+	return res
+}
+
+// subMatchValues converts a list of group indexes for each match into a list of []byte values
+func subMatchValues(str []byte, ind [][]int) [][][]byte {
+	if ind == nil {
+		return nil
 	}
 
-	e := str[trim:]
-	if len(e) != 0 {
-		res = append(res, str[trim:])
+	res := make([][][]byte, len(ind))
+	for i, pos := range ind {
+		res[i] = subMatches(str, pos)
 	}
+	return res
+}
 
+// subMatches converts a list of group index pairs into a list of []byte values
+func subMatches(str []byte, ind []int) [][]byte {
+	res := make([][]byte, len(ind)/2)
+	for i := range res {
+		if ind[i*2] >= 0 {
+			res[i] = str[ind[i*2]:ind[i*2+1]:ind[i*2+1]]
+		}
+	}
 	return res
 }
 
@@ -439,21 +938,30 @@ func (reg *Regexp) Split(str []byte) [][]byte {
 
 // Escape will escape regex special chars
 func Escape(re string) string {
-	return string(regEscape.RepStr([]byte(re), []byte(`\$1`)))
+	return string(regEscape.RepFunc([]byte(re), func(data func(int) []byte) []byte {
+		return append([]byte{'\\'}, data(0)...)
+	}))
+}
+
+// ParamList joins a list of values into a single param, for use with the %{1:list} modifier
+//
+// each value is escaped, and the values are matched as an alternation
+//
+//	regex.Comp(`\b%{1:list}\b`, regex.ParamList("cat", "dog", "a.b"))
+//	// \b(?:cat|dog|a\.b)\b
+//
+// if the param is used without the list modifier, the NUL bytes between the values are matched as they are
+func ParamList(list ...string) string {
+	return strings.Join(list, paramListSep)
 }
 
 // IsValid will return true if a regex is valid and can be compiled by this module
 func IsValid(re string) bool {
-	re = compRE(re, []string{})
-	if _, err := pcre.Compile(re, pcre.UTF8); err == nil {
-		return true
+	re, err := compRENamed(re, []string{}, nil)
+	if err != nil {
+		return false
 	}
-	return false
-}
-
-// IsValidPCRE will return true if a regex is valid and can be compiled by the PCRE module
-func IsValidPCRE(re string) bool {
-	if _, err := pcre.Compile(re, pcre.UTF8); err == nil {
+	if _, err := compile(re, Options{}); err == nil {
 		return true
 	}
 	return false
@@ -478,376 +986,121 @@ func JoinBytes(bytes ...interface{}) []byte {
 //
 // @all: if true, will replace all text matching @re,
 // if false, will only replace the first occurrence
+//
+// @maxReSize: the max length of a match in bytes (see repFile)
 func (reg *Regexp) RepFileStr(name string, rep []byte, all bool, maxReSize ...int64) error {
-	stat, err := os.Stat(name)
-	if err != nil || stat.IsDir() {
-		return err
-	}
-
-	file, err := os.OpenFile(name, os.O_RDWR, stat.Mode().Perm())
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	var found bool
-
-	l := int64(reg.len * 10)
-	if l < 1024 {
-		l = 1024
-	}
-	for _, maxRe := range maxReSize {
-		if l < maxRe {
-			l = maxRe
-		}
-	}
-
-	i := int64(0)
-
-	buf := make([]byte, l)
-	size, err := file.ReadAt(buf, i)
-	buf = buf[:size]
-	for err == nil {
-		if reg.Match(buf) {
-			found = true
-
-			repRes := reg.RepStr(buf, rep)
-
-			rl := int64(len(repRes))
-			if rl == l {
-				file.WriteAt(repRes, i)
-				file.Sync()
-			}else if rl < l {
-				file.WriteAt(repRes, i)
-				rl = l - rl
-
-				j := i+l
-
-				b := make([]byte, 1024)
-				s, e := file.ReadAt(b, j)
-				b = b[:s]
-
-				for e == nil {
-					file.WriteAt(b, j-rl)
-					j += 1024
-					b = make([]byte, 1024)
-					s, e = file.ReadAt(b, j)
-					b = b[:s]
-				}
-
-				if s != 0 {
-					file.WriteAt(b, j-rl)
-					j += int64(s)
-				}
-
-				file.Truncate(j-rl)
-				file.Sync()
-			}else if rl > l {
-				rl -= l
-
-				dif := int64(1024)
-				if rl > dif {
-					dif = rl
-				}
-
-				j := i+l
-
-				b := make([]byte, dif)
-				s, e := file.ReadAt(b, j)
-				bw := b[:s]
-
-				file.WriteAt(repRes, i)
-				j += rl
-
-				for e == nil {
-					b = make([]byte, dif)
-					s, e = file.ReadAt(b, j+dif-rl)
-				
-					file.WriteAt(bw, j)
-					bw = b[:s]
-
-					j += dif
-				}
-
-				file.WriteAt(bw, j)
-				file.Sync()
-			}
-
-			if !all {
-				file.Sync()
-				file.Close()
-				return nil
-			}
-
-			i += int64(len(repRes))
-		}
-
-		i++
-		buf = make([]byte, l)
-		size, err = file.ReadAt(buf, i)
-		buf = buf[:size]
-	}
-
-	if reg.Match(buf) {
-		found = true
-
-		repRes := reg.RepStr(buf, rep)
-
-		rl := int64(len(repRes))
-		if rl == l {
-			file.WriteAt(repRes, i)
-			file.Sync()
-		}else if rl < l {
-			file.WriteAt(repRes, i)
-			rl = l - rl
-
-			j := i+l
-
-			b := make([]byte, 1024)
-			s, e := file.ReadAt(b, j)
-			b = b[:s]
-
-			for e == nil {
-				file.WriteAt(b, j-rl)
-				j += 1024
-				b = make([]byte, 1024)
-				s, e = file.ReadAt(b, j)
-				b = b[:s]
-			}
-
-			if s != 0 {
-				file.WriteAt(b, j-rl)
-				j += int64(s)
-			}
-
-			file.Truncate(j-rl)
-			file.Sync()
-		}else if rl > l {
-			rl -= l
-
-			dif := int64(1024)
-			if rl > dif {
-				dif = rl
-			}
-
-			j := i+l
-
-			b := make([]byte, dif)
-			s, e := file.ReadAt(b, j)
-			bw := b[:s]
-
-			file.WriteAt(repRes, i)
-			j += rl
-
-			for e == nil {
-				b = make([]byte, dif)
-				s, e = file.ReadAt(b, j+dif-rl)
-			
-				file.WriteAt(bw, j)
-				bw = b[:s]
-
-				j += dif
-			}
-
-			file.WriteAt(bw, j)
-			file.Sync()
-		}
-	}
-
-	file.Sync()
-	file.Close()
-
-	if !found {
-		return io.EOF
-	}
-	return nil
+	return reg.repFile(name, func(data func(int) []byte) []byte {
+		return reg.expand(rep, data)
+	}, all, maxReSize)
 }
 
 // RepFileFunc replaces a regex match with the result of a callback function in a file
 //
 // @all: if true, will replace all text matching @re,
 // if false, will only replace the first occurrence
+//
+// @maxReSize: the max length of a match in bytes (see repFile)
 func (reg *Regexp) RepFileFunc(name string, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) error {
+	return reg.repFile(name, rep, all, maxReSize)
+}
+
+// repFile streams a file through a RepWriter into a temporary file in the same directory,
+// and then renames the temporary file over the original
+//
+// the original file is never modified in place, so it is left unchanged if anything fails (or the process dies) part way through.
+// the temporary file keeps the mode of the original file, and is synced to disk before the rename.
+//
+// a rename only needs write access to the directory, so an error is returned if the process cannot write to the file itself.
+// the owner of the file is only kept if the process is allowed to change it.
+// otherwise (ie: a user editing a group writable file they do not own) the replaced file is owned by the user and group of the process
+//
+// by default, there is no limit to the length of a match, so the result is the same as running RepStr on the whole file.
+// @maxReSize can be used to set a limit, and keep memory bounded for very large files.
+//
+// if nothing matched, the file is left unchanged and io.EOF is returned
+func (reg *Regexp) repFile(name string, rep func(data func(int) []byte) []byte, all bool, maxReSize []int64) error {
+	name, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+
 	stat, err := os.Stat(name)
 	if err != nil || stat.IsDir() {
 		return err
 	}
 
-	file, err := os.OpenFile(name, os.O_RDWR, stat.Mode().Perm())
+	// the file is replaced by a rename, so check that it could also be written to in place
+	if file, err := os.OpenFile(name, os.O_WRONLY, 0); err != nil {
+		return err
+	}else{
+		file.Close()
+	}
+
+	file, err := os.Open(name)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	var found bool
-
-	l := int64(reg.len * 10)
-	if l < 1024 {
-		l = 1024
-	}
-	for _, maxRe := range maxReSize {
-		if l < maxRe {
-			l = maxRe
-		}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
 	}
+	defer func(){
+		// does nothing if the file was already renamed
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
 
-	i := int64(0)
-
-	buf := make([]byte, l)
-	size, err := file.ReadAt(buf, i)
-	buf = buf[:size]
-	for err == nil {
-		if reg.Match(buf) {
-			found = true
-
-			repRes := reg.RepFunc(buf, rep)
-
-			rl := int64(len(repRes))
-			if rl == l {
-				file.WriteAt(repRes, i)
-				file.Sync()
-			}else if rl < l {
-				file.WriteAt(repRes, i)
-				rl = l - rl
-
-				j := i+l
-
-				b := make([]byte, 1024)
-				s, e := file.ReadAt(b, j)
-				b = b[:s]
-
-				for e == nil {
-					file.WriteAt(b, j-rl)
-					j += 1024
-					b = make([]byte, 1024)
-					s, e = file.ReadAt(b, j)
-					b = b[:s]
-				}
-
-				if s != 0 {
-					file.WriteAt(b, j-rl)
-					j += int64(s)
-				}
-
-				file.Truncate(j-rl)
-				file.Sync()
-			}else if rl > l {
-				rl -= l
-
-				dif := int64(1024)
-				if rl > dif {
-					dif = rl
-				}
-
-				j := i+l
-
-				b := make([]byte, dif)
-				s, e := file.ReadAt(b, j)
-				bw := b[:s]
+	maxSize := int64(0)
+	if len(maxReSize) != 0 {
+		maxSize = maxReSize[0]
+	}
 
-				file.WriteAt(repRes, i)
-				j += rl
+	rw := reg.NewRepWriterFunc(tmp, rep, maxSize)
+	rw.once = !all
 
-				for e == nil {
-					b = make([]byte, dif)
-					s, e = file.ReadAt(b, j+dif-rl)
-				
-					file.WriteAt(bw, j)
-					bw = b[:s]
+	if _, err := io.Copy(rw, file); err != nil {
+		return err
+	}
+	if err := rw.Close(); err != nil {
+		return err
+	}
 
-					j += dif
-				}
+	if !rw.found {
+		return io.EOF
+	}
 
-				file.WriteAt(bw, j)
-				file.Sync()
-			}
+	if err := tmp.Chmod(stat.Mode()); err != nil {
+		return err
+	}
 
-			if !all {
-				file.Sync()
-				file.Close()
-				return nil
+	// the owner is only kept if the process is allowed to change it (a user can edit a group writable file they do not own),
+	// so an error from chown is ignored, and the file is owned by the process instead (see the docs above)
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		if tmpStat, err := tmp.Stat(); err == nil {
+			if tmpSys, ok := tmpStat.Sys().(*syscall.Stat_t); ok && (tmpSys.Uid != sys.Uid || tmpSys.Gid != sys.Gid) {
+				tmp.Chown(int(sys.Uid), int(sys.Gid))
 			}
-
-			i += int64(len(repRes))
 		}
-
-		i++
-		buf = make([]byte, l)
-		size, err = file.ReadAt(buf, i)
-		buf = buf[:size]
 	}
 
-	if reg.Match(buf) {
-		found = true
-
-		repRes := reg.RepFunc(buf, rep)
-
-		rl := int64(len(repRes))
-		if rl == l {
-			file.WriteAt(repRes, i)
-			file.Sync()
-		}else if rl < l {
-			file.WriteAt(repRes, i)
-			rl = l - rl
-
-			j := i+l
-
-			b := make([]byte, 1024)
-			s, e := file.ReadAt(b, j)
-			b = b[:s]
-
-			for e == nil {
-				file.WriteAt(b, j-rl)
-				j += 1024
-				b = make([]byte, 1024)
-				s, e = file.ReadAt(b, j)
-				b = b[:s]
-			}
-
-			if s != 0 {
-				file.WriteAt(b, j-rl)
-				j += int64(s)
-			}
-
-			file.Truncate(j-rl)
-			file.Sync()
-		}else if rl > l {
-			rl -= l
-
-			dif := int64(1024)
-			if rl > dif {
-				dif = rl
-			}
-
-			j := i+l
-
-			b := make([]byte, dif)
-			s, e := file.ReadAt(b, j)
-			bw := b[:s]
-
-			file.WriteAt(repRes, i)
-			j += rl
-
-			for e == nil {
-				b = make([]byte, dif)
-				s, e = file.ReadAt(b, j+dif-rl)
-			
-				file.WriteAt(bw, j)
-				bw = b[:s]
-
-				j += dif
-			}
-
-			file.WriteAt(bw, j)
-			file.Sync()
-		}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
 	}
 
-	file.Sync()
-	file.Close()
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
 
-	if !found {
-		return io.EOF
+	// sync the directory so the rename is also saved to disk
+	if dir, err := os.Open(filepath.Dir(name)); err == nil {
+		dir.Sync()
+		dir.Close()
 	}
+
 	return nil
 }
@@ -2,16 +2,25 @@ package regex
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"io"
+	"io/fs"
 	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"strconv"
+	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
 func TestCompile(t *testing.T) {
 	reC := Comp("this is test %1", "a")
-	if reC.RE.ReplaceAllString(`this is test a`, `this is test b`, 0) != `this is test b` {
+	if string(reC.RepStrLit([]byte(`this is test a`), []byte(`this is test b`))) != `this is test b` {
 		t.Error(`[this is test %1] [a]`, "\n", errors.New("failed to compile params"))
 	}
 
@@ -27,6 +36,18 @@ func TestCompile(t *testing.T) {
 	}
 }
 
+func TestEscape(t *testing.T) {
+	if res := Escape(`a.b(c)`); res != `a\.b\(c\)` {
+		t.Error("[", res, "]\n", errors.New("escaped string does not match expected result"))
+	}
+
+	// every special char should be matched as it is
+	str := `\^$.|?*+()[]{}%`
+	if reg, err := CompTry(`^` + Escape(str) + `$`); err != nil || !reg.Match([]byte(str)) || reg.Match([]byte("a")) {
+		t.Error("[", Escape(str), "]\n", errors.New("escaped special chars do not match themselves"), err)
+	}
+}
+
 func TestReplaceStr(t *testing.T) {
 	var check = func(s string, re, r string, e string) {
 		res := Comp(re).RepStrLit([]byte(s), []byte(r))
@@ -129,3 +150,970 @@ func TestValid(t *testing.T) {
 	check(`(?<test>)`, true)
 	check(`(?i)test`, true)
 }
+
+func TestFind(t *testing.T) {
+	reg := Comp(`(t)(e)?st`)
+
+	if res := reg.Find([]byte("a test string")); !bytes.Equal(res, []byte("test")) {
+		t.Error("[", string(res), "]\n", errors.New("result does not match expected result"))
+	}
+
+	if res := reg.FindIndex([]byte("a test string")); len(res) != 2 || res[0] != 2 || res[1] != 6 {
+		t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+	}
+
+	if res := reg.Find([]byte("no match")); res != nil {
+		t.Error("[", string(res), "]\n", errors.New("result should be nil"))
+	}
+
+	if res := reg.FindAll([]byte("test tst test"), -1); len(res) != 3 || !bytes.Equal(res[1], []byte("tst")) {
+		t.Error("[", len(res), "]\n", errors.New("result does not match expected result"))
+	}
+
+	if res := reg.FindAll([]byte("test tst test"), 2); len(res) != 2 {
+		t.Error("[", len(res), "]\n", errors.New("n limit was not respected"))
+	}
+
+	if res := reg.FindSubmatch([]byte("a tst")); len(res) != 3 || !bytes.Equal(res[1], []byte("t")) || res[2] != nil {
+		t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+	}
+
+	if res := reg.FindAllSubmatch([]byte("test tst"), -1); len(res) != 2 || !bytes.Equal(res[0][2], []byte("e")) {
+		t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+	}
+
+	if res := Comp(`a*`).FindAllIndex([]byte("baaac"), -1); len(res) != 3 {
+		t.Error("[", res, "]\n", errors.New("empty matches were not handled correctly"))
+	}
+
+	if res := Comp(`^a`).FindAll([]byte("aaa"), -1); len(res) != 1 {
+		t.Error("[", len(res), "]\n", errors.New("^ matched after the start of the input"))
+	}
+
+	if res := Comp(`\bb`).FindAllIndex([]byte("ab b"), -1); len(res) != 1 || res[0][0] != 3 {
+		t.Error("[", res, "]\n", errors.New("word boundary did not use the previous char"))
+	}
+}
+
+func TestNamedGroups(t *testing.T) {
+	reg := Comp(`(?<user>\w+)@(\w+)\.(?P<tld>com|org)`)
+
+	if names := reg.SubexpNames(); len(names) != 4 || names[1] != "user" || names[2] != "" || names[3] != "tld" {
+		t.Error("[", names, "]\n", errors.New("result does not match expected result"))
+	}
+
+	if i := reg.SubexpIndex("tld"); i != 3 {
+		t.Error("[", i, "]\n", errors.New("result does not match expected result"))
+	}
+
+	if i := reg.SubexpIndex("missing"); i != -1 {
+		t.Error("[", i, "]\n", errors.New("result does not match expected result"))
+	}
+
+	if res := reg.RepStr([]byte("mail admin@example.com now"), []byte("${tld}:${user}")); !bytes.Equal(res, []byte("mail com:admin now")) {
+		t.Error("[", string(res), "]\n", errors.New("result does not match expected result"))
+	}
+
+	res := reg.RepFuncNamed([]byte("mail admin@example.org now"), func(data func(int) []byte, named func(string) []byte) []byte {
+		return JoinBytes(named("user"), ' ', data(2))
+	})
+	if !bytes.Equal(res, []byte("mail admin example now")) {
+		t.Error("[", string(res), "]\n", errors.New("result does not match expected result"))
+	}
+
+	if names := Comp(`[(?<a>)](\()(?#(?<b>)(?:c)\Q(e)\E`).SubexpNames(); len(names) != 2 {
+		t.Error("[", names, "]\n", errors.New("non capture groups were counted"))
+	}
+}
+
+func TestContext(t *testing.T) {
+	reg := Comp(`(t)est`)
+
+	if ok, err := reg.MatchContext(context.Background(), []byte("a test")); !ok || err != nil {
+		t.Error("[", ok, err, "]\n", errors.New("result does not match expected result"))
+	}
+
+	res, err := reg.RepStrContext(context.Background(), []byte("a test"), []byte("$1"))
+	if err != nil || !bytes.Equal(res, []byte("a t")) {
+		t.Error("[", string(res), err, "]\n", errors.New("result does not match expected result"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := reg.SplitContext(ctx, []byte("a test")); !errors.Is(err, context.Canceled) {
+		t.Error("[", err, "]\n", errors.New("canceled context did not return an error"))
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	str := bytes.Repeat([]byte("test "), 100)
+	res, err = reg.RepFuncContext(ctx, str, func(data func(int) []byte) []byte {
+		time.Sleep(5 * time.Millisecond)
+		return data(1)
+	})
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || !timeoutErr.Timeout() {
+		t.Error("[", err, "]\n", errors.New("deadline did not return a timeout error"))
+	}else if !bytes.Equal(res, str) {
+		t.Error("[", string(res), "]\n", errors.New("input should be returned unchanged on error"))
+	}
+
+	if EngineName == "pcre" {
+		limit := ContextMatchLimit
+		t.Cleanup(func(){
+			ContextMatchLimit = limit
+		})
+		ContextMatchLimit = 1000
+
+		// a match attempt that cannot be interrupted should stop at the match limit, instead of running in the background after the deadline
+		str = []byte(strings.Repeat("a", 16) + "b")
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if ok, err := Comp(`(a+)+$`).MatchContext(ctx, str); ok || err == nil || errors.As(err, &timeoutErr) {
+			t.Error("[", ok, err, "]\n", errors.New("match limit was not used"))
+		}
+
+		if ok, err := Comp(`(a+)+$`).MatchContext(context.Background(), str); ok || err != nil {
+			t.Error("[", ok, err, "]\n", errors.New("match limit should only be used when the context can be done"))
+		}
+	}
+}
+
+func TestReplaceReader(t *testing.T) {
+	var check = func(s string, re, r string, maxReSize ...int64) {
+		reg := Comp(re)
+		e := reg.RepStr([]byte(s), []byte(r))
+
+		var res bytes.Buffer
+		if err := reg.RepReader(iotest.OneByteReader(strings.NewReader(s)), &res, []byte(r), maxReSize...); err != nil {
+			t.Error("[", re, "]\n", err)
+		}else if !bytes.Equal(res.Bytes(), e) {
+			t.Error("[", res.String(), "]\n", errors.New("result does not match RepStr result"))
+		}
+	}
+
+	long := strings.Repeat("some text with a key=value pair, and unicode ☕ chars\n", 2000)
+	check(long, `(\w+)=(\w+)`, "$2=$1")
+	check(long, `(\w+)=(\w+)`, "$2=$1", 16)
+	check(long, `☕`, "coffee", 16)
+	check(long, `(?m)^some`, "a", 0)
+	check("aaa bbb", `b*`, "-")
+
+	var res bytes.Buffer
+	rw := Comp(`(t)est`).NewRepWriterFunc(&res, func(data func(int) []byte) []byte {
+		return data(1)
+	})
+	rw.Write([]byte("a te"))
+	rw.Write([]byte("st and a test"))
+	if err := rw.Close(); err != nil || res.String() != "a t and a t" {
+		t.Error("[", res.String(), err, "]\n", errors.New("result does not match expected result"))
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.txt")
+	str := []byte(strings.Repeat("a key=value pair, and another key=value pair\n", 1000))
+	if err := os.WriteFile(name, str, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := Comp(`(\w+)=(\w+)`)
+	if err := reg.RepFileStr(name, []byte("$2=$1"), true); err != nil {
+		t.Error("[", name, "]\n", err)
+	}
+
+	if res, _ := os.ReadFile(name); !bytes.Equal(res, reg.RepStr(str, []byte("$2=$1"))) {
+		t.Error("[", name, "]\n", errors.New("result does not match RepStr result"))
+	}
+
+	if stat, err := os.Stat(name); err != nil || stat.Mode().Perm() != 0640 {
+		t.Error("[", name, "]\n", errors.New("file mode was not preserved"))
+	}
+
+	err := Comp(`(pair)`).RepFileFunc(name, func(data func(int) []byte) []byte {
+		return []byte("PAIR")
+	}, false)
+	if res, _ := os.ReadFile(name); err != nil || bytes.Count(res, []byte("PAIR")) != 1 {
+		t.Error("[", name, "]\n", errors.New("more than the first match was replaced"))
+	}
+
+	before, _ := os.ReadFile(name)
+	if err := Comp(`not found`).RepFileStr(name, []byte(""), true); err != io.EOF {
+		t.Error("[", name, "]\n", errors.New("io.EOF was not returned when nothing matched"))
+	}
+	if res, _ := os.ReadFile(name); !bytes.Equal(res, before) {
+		t.Error("[", name, "]\n", errors.New("file changed when nothing matched"))
+	}
+
+	if files, _ := os.ReadDir(filepath.Dir(name)); len(files) != 1 {
+		t.Error("[", name, "]\n", errors.New("temp files were not removed"))
+	}
+}
+
+func TestReplaceFileOwner(t *testing.T) {
+	// the test below runs this as another user
+	if name := os.Getenv("REGEX_TEST_OWNER_FILE"); name != "" {
+		err := Comp(`a`).RepFileStr(name, []byte("b"), true)
+		if os.Getenv("REGEX_TEST_OWNER_DENIED") != "" {
+			if !errors.Is(err, fs.ErrPermission) {
+				t.Fatal("a file that is not writable was replaced: ", err)
+			}
+		}else if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of a file needs root")
+	}
+
+	dir, err := os.MkdirTemp("", "regex-owner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, 0777)
+
+	// the owner of a file is kept when the process can change it
+	name := filepath.Join(dir, "test.txt")
+	os.WriteFile(name, []byte("aaa"), 0666)
+	os.Chmod(name, 0666)
+	os.Chown(name, 65534, 65534)
+
+	if err := Comp(`a`).RepFileStr(name, []byte("b"), true); err != nil {
+		t.Error("[", name, "]\n", err)
+	}
+	if stat, err := os.Stat(name); err != nil || stat.Sys().(*syscall.Stat_t).Uid != 65534 {
+		t.Error("[", name, "]\n", errors.New("file owner was not preserved"))
+	}
+
+	// a user that cannot change the owner of a writable file can still replace it
+	os.WriteFile(name, []byte("aaa"), 0666)
+	os.Chown(name, 0, 0)
+
+	bin := filepath.Join(dir, "regex.test")
+	if buf, err := os.ReadFile(os.Args[0]); err != nil || os.WriteFile(bin, buf, 0755) != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bin, "-test.run=^TestReplaceFileOwner$")
+	cmd.Env = append(os.Environ(), "REGEX_TEST_OWNER_FILE="+name)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Error("[", name, err, "]\n", errors.New(string(out)))
+	}
+
+	if res, _ := os.ReadFile(name); string(res) != "bbb" {
+		t.Error("[", string(res), "]\n", errors.New("file was not replaced by another user"))
+	}
+	if stat, err := os.Stat(name); err != nil || stat.Mode().Perm() != 0666 {
+		t.Error("[", name, "]\n", errors.New("file mode was not preserved"))
+	}
+
+	// a file the user cannot write to should not be replaced, even though they can write to the directory
+	for _, mode := range []struct{uid int; perm os.FileMode}{{0, 0644}, {65534, 0444}} {
+		os.WriteFile(name, []byte("aaa"), mode.perm)
+		os.Chmod(name, mode.perm)
+		os.Chown(name, mode.uid, mode.uid)
+
+		cmd := exec.Command(bin, "-test.run=^TestReplaceFileOwner$")
+		cmd.Env = append(os.Environ(), "REGEX_TEST_OWNER_FILE="+name, "REGEX_TEST_OWNER_DENIED=1")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Error("[", name, mode.perm, err, "]\n", errors.New(string(out)))
+		}
+
+		if res, _ := os.ReadFile(name); string(res) != "aaa" {
+			t.Error("[", string(res), mode.perm, "]\n", errors.New("file that is not writable was replaced"))
+		}
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := NewLRUCache(2, 0)
+	SetCache(c)
+	defer SetCache(nil)
+
+	Comp(`lru a`)
+	Comp(`lru b`)
+	Comp(`lru a`)
+	Comp(`lru c`)
+
+	if c.Len() != 2 {
+		t.Error("[", c.Len(), "]\n", errors.New("cache was not bounded by its max entries"))
+	}
+
+	if val, _ := c.Get(`lru b`); val != nil {
+		t.Error("[lru b]\n", errors.New("least recently used item was not removed"))
+	}
+
+	if val, _ := c.Get(`lru a`); val == nil {
+		t.Error("[lru a]\n", errors.New("recently used item was removed"))
+	}
+
+	if _, err := CompTry(`lru (`); err == nil {
+		t.Error("[lru (]\n", errors.New("invalid regex did not return an error"))
+	}
+	if _, err := c.Get(`lru (`); err == nil {
+		t.Error("[lru (]\n", errors.New("compile error was not cached"))
+	}
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Error("[", c.Len(), "]\n", errors.New("cache was not purged"))
+	}
+
+	SetCache(NewLRUCache(0, 512))
+	for i := 0; i < 100; i++ {
+		Comp(`lru bytes ` + strconv.Itoa(i))
+	}
+	if l := getCache().Len(); l >= 100 || l == 0 {
+		t.Error("[", l, "]\n", errors.New("cache was not bounded by its max bytes"))
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	SetCache(NewLRUCache(1, 0))
+	defer SetCache(nil)
+	ResetCacheStats()
+
+	Comp(`stats a`)
+	Comp(`stats a`)
+	CompTry(`stats (`)
+	CompTry(`stats (`)
+	Comp(`stats b`)
+
+	stats := GetCacheStats()
+	if stats.Comp.Hits != 1 || stats.Comp.NegativeHits != 1 || stats.Comp.Misses != 3 {
+		t.Error("[", stats.Comp, "]\n", errors.New("cache counters do not match expected result"))
+	}
+
+	if stats.Comp.Evictions != 2 || stats.Comp.Entries != 1 || stats.Comp.Bytes == 0 {
+		t.Error("[", stats.Comp, "]\n", errors.New("cache size does not match expected result"))
+	}
+
+	if stats.CompRE.Hits == 0 || stats.CompRE.Entries == 0 {
+		t.Error("[", stats.CompRE, "]\n", errors.New("compRE cache counters do not match expected result"))
+	}
+
+	snap := CacheSnapshot()
+	if len(snap.Comp) != 1 || snap.Comp[0].Key != `stats b` || snap.Comp[0].LastUse.IsZero() {
+		t.Error("[", snap.Comp, "]\n", errors.New("snapshot does not match expected result"))
+	}
+
+	// items removed by DelOld for being too old are evictions, and items removed by Delete are not
+	cache := NewLRUCache(0, 0)
+	cache.Set(`a`, Comp(`a`), nil)
+	cache.Set(`b`, Comp(`b`), nil)
+	cache.Delete(`a`)
+	time.Sleep(2 * time.Millisecond)
+	cache.(interface{ DelOld(time.Duration) }).DelOld(time.Millisecond)
+	if e := cache.(interface{ Evictions() uint64 }).Evictions(); e != 1 || cache.Len() != 0 {
+		t.Error("[", e, "]\n", errors.New("evictions do not match expected result"))
+	}
+}
+
+func TestCompOpts(t *testing.T) {
+	if !CompOpts(`hello`, Options{CaseInsensitive: true}).Match([]byte("HeLLo")) {
+		t.Error("[", `hello`, "]\n", errors.New("case insensitive option did not match"))
+	}
+
+	if Comp(`hello`).Match([]byte("HeLLo")) {
+		t.Error("[", `hello`, "]\n", errors.New("options leaked into the cache entry without options"))
+	}
+
+	if res := CompOpts(`^b$`, Options{Multiline: true}).FindAll([]byte("a\nb\nc"), -1); len(res) != 1 {
+		t.Error("[", len(res), "]\n", errors.New("multiline option did not match"))
+	}
+
+	if res := CompOpts(`a.c`, Options{DotAll: true, JIT: true}).Find([]byte("a\nc")); string(res) != "a\nc" {
+		t.Error("[", string(res), "]\n", errors.New("dotall option did not match"))
+	}
+
+	if res := CompOpts(`a+`, Options{Ungreedy: true}).Find([]byte("aaa")); string(res) != "a" {
+		t.Error("[", string(res), "]\n", errors.New("ungreedy option did not match"))
+	}
+
+	if _, err := CompOptsTry(`a(`, Options{CaseInsensitive: true}); err == nil {
+		t.Error("[", `a(`, "]\n", errors.New("invalid regex compiled with options"))
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := CompSet([]string{`error`, `warn(ing)?`, `(u)ser %1`, `^start`, `miss`}, `b.b`)
+
+	res := set.Matches([]byte("start: warning, user b.b had an error"))
+	if len(res) != 4 || res[0] != 0 || res[1] != 1 || res[2] != 2 || res[3] != 3 {
+		t.Error("[", res, "]\n", errors.New("set matches do not match expected result"))
+	}
+
+	ind := set.MatchIndex([]byte("a warn, user b.b"))
+	if ind[0] != nil || ind[1] == nil || ind[1][0] != 2 || ind[1][1] != 6 || ind[2] == nil || ind[2][0] != 8 || ind[3] != nil {
+		t.Error("[", ind, "]\n", errors.New("set match index does not match expected result"))
+	}
+
+	if set.Match([]byte("user bab")) || !set.Match([]byte("miss")) {
+		t.Error("[", set.Len(), "]\n", errors.New("set match does not match expected result"))
+	}
+
+	if _, err := CompSetTry([]string{`ok`, `bad(`}); err == nil {
+		t.Error("[", `bad(`, "]\n", errors.New("invalid regex compiled in set"))
+	}
+}
+
+func TestString(t *testing.T) {
+	if !Comp(`wo(r)ld`).MatchString("hello world") || Comp(`wo(r)ld`).MatchString("hello") {
+		t.Error("[", `wo(r)ld`, "]\n", errors.New("match string does not match expected result"))
+	}
+
+	if res := Comp(`(\w+) (?<last>\w+)`).RepStrString("hello world", "${last} $1"); res != "world hello" {
+		t.Error("[", res, "]\n", errors.New("replace string does not match expected result"))
+	}
+
+	if res := Comp(`a(b)?`).RepFuncString("a ab c", func(data func(int) string) string {
+		return "[" + data(1) + "]"
+	}); res != "[] [b] c" {
+		t.Error("[", res, "]\n", errors.New("replace func string does not match expected result"))
+	}
+
+	if res := Comp(`a`).RepFuncString("aaa", func(data func(int) string) string { return "" }); res != "" {
+		t.Error("[", res, "]\n", errors.New("replace func string stopped early on an empty result"))
+	}
+
+	if res := Comp(`,|(;)`).SplitString("a,b;c"); len(res) != 4 || res[0] != "a" || res[1] != "b" || res[2] != ";" || res[3] != "c" {
+		t.Error("[", res, "]\n", errors.New("split string does not match expected result"))
+	}
+
+	if res := Comp(`(\d)(x)?`).FindAllStringSubmatch("1x 2", -1); len(res) != 2 || res[0][2] != "x" || res[1][1] != "2" || res[1][2] != "" {
+		t.Error("[", res, "]\n", errors.New("find all string submatch does not match expected result"))
+	}
+
+	if res := Comp(`\d`).FindString("abc"); res != "" {
+		t.Error("[", res, "]\n", errors.New("find string does not match expected result"))
+	}
+}
+
+func TestIterFunc(t *testing.T) {
+	n := 0
+	Comp(`a`).AllFunc([]byte("aaaa"), func(match []byte) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Error("[", n, "]\n", errors.New("iterator callback did not stop early"))
+	}
+}
+
+func TestReplaceTree(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("one\ntwo\nthree\nfoo bar\n"), 0644)
+	os.WriteFile(filepath.Join(root, "b.md"), []byte("foo\n"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "c.txt"), []byte("foo foo"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "deep", "d.txt"), []byte("foo\n"), 0644)
+
+	reg := Comp(`foo`)
+
+	res, err := reg.RepTreeStr(root, []byte("baz"), TreeOptions{Include: []string{"*.txt"}, Exclude: []string{"deep"}, DryRun: true})
+	if err != nil || len(res) != 2 {
+		t.Error("[", res, err, "]\n", errors.New("dry run changes do not match expected result"))
+	}else{
+		if res[0].Matches != 1 || res[0].Diff != "--- a/a.txt\n+++ b/a.txt\n@@ -1,4 +1,4 @@\n one\n two\n three\n-foo bar\n+baz bar\n" {
+			t.Error("[", res[0].Diff, "]\n", errors.New("dry run diff does not match expected result"))
+		}
+		if res[1].Matches != 2 || res[1].Diff != "--- a/sub/c.txt\n+++ b/sub/c.txt\n@@ -1,1 +1,1 @@\n-foo foo\n\\ No newline at end of file\n+baz baz\n\\ No newline at end of file\n" {
+			t.Error("[", res[1].Diff, "]\n", errors.New("dry run diff does not match expected result"))
+		}
+	}
+
+	if buf, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(buf) != "one\ntwo\nthree\nfoo bar\n" {
+		t.Error("[", string(buf), "]\n", errors.New("dry run modified a file"))
+	}
+
+	res, err = reg.RepTreeStr(root, []byte("baz"), TreeOptions{MaxDepth: 2})
+	if err != nil || len(res) != 3 {
+		t.Error("[", res, err, "]\n", errors.New("tree changes do not match expected result"))
+	}
+
+	if buf, _ := os.ReadFile(filepath.Join(root, "sub", "c.txt")); string(buf) != "baz baz" {
+		t.Error("[", string(buf), "]\n", errors.New("tree replace does not match expected result"))
+	}
+
+	if buf, _ := os.ReadFile(filepath.Join(root, "sub", "deep", "d.txt")); string(buf) != "foo\n" {
+		t.Error("[", string(buf), "]\n", errors.New("tree replace ignored the max depth"))
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	a, b := [][]byte{}, [][]byte{}
+	for i := 0; i < diffMaxEdits; i++ {
+		a = append(a, []byte("a"+strconv.Itoa(i)+"\n"))
+		b = append(b, []byte("b"+strconv.Itoa(i)+"\n"))
+	}
+	a = append([][]byte{[]byte("same\n")}, a...)
+	b = append([][]byte{[]byte("same\n")}, b...)
+
+	// more changes than diffMaxEdits are shown as a single removal and addition
+	ops := diffLines(a, b)
+	if len(ops) != diffMaxEdits*2+1 || ops[0].kind != ' ' || ops[1].kind != '-' || ops[diffMaxEdits+1].kind != '+' || string(ops[diffMaxEdits+1].line) != "b0\n" {
+		t.Error("[", len(ops), "]\n", errors.New("large diff does not match expected result"))
+	}
+
+	ops = diffLines(splitLines([]byte("a\nb\nc\nd\n")), splitLines([]byte("a\nc\nx\nd\n")))
+	res := ""
+	for _, op := range ops {
+		res += string(op.kind) + string(op.line)
+	}
+	if res != " a\n-b\n c\n+x\n d\n" {
+		t.Error("[", res, "]\n", errors.New("diff does not match expected result"))
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	_, err := CompTry(`(?#comment)ab%1(`, `x`)
+
+	cerr, ok := err.(*CompileError)
+	if !ok {
+		t.Error("[", err, "]\n", errors.New("compile error is not a *CompileError"))
+		return
+	}
+
+	if cerr.Pattern != `(?#comment)ab%1(` || cerr.Expanded != `abx(` || cerr.Offset < 11 || cerr.Message == "" {
+		t.Error("[", cerr.Pattern, cerr.Expanded, cerr.Offset, "]\n", errors.New("compile error does not match expected result"))
+	}
+
+	if _, err := CompTry(`(?#comment)ab%1(`, `x`); err == nil || err.Error() != cerr.Error() {
+		t.Error("[", err, "]\n", errors.New("cached compile error does not match the first error"))
+	}
+
+	// patterns that expand to the same regex share a cache entry, but not the offset of the error
+	for _, test := range []struct{re string; offset int}{
+		{`a(`, 1},
+		{`(?#some long comment)a(`, 22},
+		{`a(`, 1},
+	} {
+		_, err := CompTry(test.re)
+		if cerr, ok := err.(*CompileError); !ok || cerr.Pattern != test.re || cerr.Expanded != `a(` || (cerr.Offset != -1 && cerr.Offset < test.offset-1) {
+			t.Error("[", test.re, err, "]\n", errors.New("cached compile error does not match the pattern"))
+		}
+	}
+
+	_, err = CompNamedTry(`%{x}(`, map[string]string{"x": "a"})
+	if cerr, ok := err.(*CompileError); !ok || cerr.Pattern != `%{x}(` || cerr.Expanded != `a(` {
+		t.Error("[", err, "]\n", errors.New("cached compile error does not match the pattern"))
+	}
+
+	srcMap := compREMap(`(?#c)a%1[cb]`, []string{`x.y`}, nil)
+	if res := compRE(`(?#c)a%1[cb]`, []string{`x.y`}); len(srcMap) != len(res)+1 {
+		t.Error("[", res, srcMap, "]\n", errors.New("compRE map does not match the length of the expanded regex"))
+	}else if srcMap[0] != 5 || srcMap[1] != 6 || srcMap[4] != 6 || srcMap[5] != 8 || srcMap[len(res)] != 12 {
+		t.Error("[", srcMap, "]\n", errors.New("compRE map does not match expected result"))
+	}
+
+	pretty := (&CompileError{Message: "missing )", Offset: 4, Pattern: "a\n\tb(c"}).Pretty()
+	if pretty != "regex: missing ) at offset 4\n\tb(c\n\t ^" {
+		t.Error("[", pretty, "]\n", errors.New("pretty compile error does not match expected result"))
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		re string
+		severity Severity
+		kind string
+	}{
+		{`^[a-z0-9_.-]+@[a-z0-9.-]+$`, SeverityNone, ""},
+		{`(a+b)+c`, SeverityNone, ""},
+		{`(?>a+)+b`, SeverityNone, ""},
+		{`(a++)+b`, SeverityNone, ""},
+		{`(\d{1,3}\.){3}\d{1,3}`, SeverityNone, ""},
+		{`(a|b)*c`, SeverityNone, ""},
+		{`(a+)+$`, SeverityHigh, "nested quantifier"},
+		{`^(\w+\s?)*$`, SeverityHigh, "nested quantifier"},
+		{`(x+x+)+y`, SeverityHigh, "nested quantifier"},
+		{`(a+.)+`, SeverityHigh, "nested quantifier"},
+		{`^(([a-z])+.)+[A-Z]([a-z])+$`, SeverityHigh, "nested quantifier"},
+		{`(?:a|a)*b`, SeverityHigh, "overlapping alternation"},
+		{`(\w|\d)+$`, SeverityHigh, "overlapping alternation"},
+		{`(?i)(?:a|A)+$`, SeverityHigh, "overlapping alternation"},
+		{`\d+\d+$`, SeverityMedium, "adjacent quantifiers"},
+		{`^.*=.*;`, SeverityMedium, "adjacent quantifiers"},
+		{`[^"]*\s*[a-z]+`, SeverityMedium, "adjacent quantifiers"},
+	}
+
+	for _, test := range tests {
+		report := Analyze(test.re)
+
+		// a pattern can have more than one issue, so look for the one with the highest severity
+		found := test.kind == ""
+		for _, issue := range report.Issues {
+			if issue.Kind == test.kind && issue.Severity == test.severity {
+				found = true
+			}
+		}
+
+		if report.Err != nil || report.Severity != test.severity || !found {
+			t.Error("[", test.re, report, "]\n", errors.New("analyze report does not match expected result"))
+		}
+	}
+
+	report := Analyze(`(?#comment)x(%1+)+`, `a`)
+	if len(report.Issues) != 1 || report.Issues[0].Offset != 12 || report.Issues[0].Expr != `(a+)+` {
+		t.Error("[", report.Issues, "]\n", errors.New("analyze issue does not match expected result"))
+	}
+
+	if report := Analyze(`a(b`); !errors.Is(report.Err, ErrAnalyzeParse) || report.Safe() {
+		t.Error("[", report.Err, "]\n", errors.New("analyze did not return a parse error"))
+	}
+
+	// chars above the max unicode value should not panic
+	for _, re := range []string{`\x{FFFFFFFF}`, `[\x{FFFFFFFF}]`, `\o{37777777777}`, `\x{110000}+`, `[a\x{FFFFFFFFFF}]`} {
+		if report := Analyze(re); !errors.Is(report.Err, ErrAnalyzeParse) {
+			t.Error("[", re, report.Err, "]\n", errors.New("analyze did not return a parse error"))
+		}
+	}
+}
+
+func TestCompNamed(t *testing.T) {
+	reg := CompNamed(`%{user}@%{host}\.com \%1 \%{host}`, map[string]string{"user": "a.b", "host": "example"})
+	if !reg.Match([]byte(`a.b@example.com %1 %{host}`)) || reg.Match([]byte(`axb@example.com %1 %{host}`)) {
+		t.Error("[", `%{user}@%{host}`, "]\n", errors.New("named params do not match expected result"))
+	}
+
+	_, err := CompNamedTry(`(?#c)%{user}:%{pass}`, map[string]string{"user": "a"})
+	cerr, ok := err.(*CompileError)
+	if !ok || !errors.Is(err, ErrMissingParam) || cerr.Offset != 13 || !strings.Contains(cerr.Message, "%{pass}") {
+		t.Error("[", err, "]\n", errors.New("missing named param did not return an error"))
+	}
+
+	if _, err := CompNamedTry(`%1`, nil); !errors.Is(err, ErrMissingParam) {
+		t.Error("[", err, "]\n", errors.New("missing positional param did not return an error"))
+	}
+
+	if !Comp(`%{user}`).Match([]byte("%{user}")) {
+		t.Error("[", `%{user}`, "]\n", errors.New("named params should be unchanged without CompNamed"))
+	}
+}
+
+func TestParamModifiers(t *testing.T) {
+	reg := Comp(`^%{1:list}$`, ParamList("cat", "dog", "a.b"))
+	if !reg.Match([]byte("dog")) || !reg.Match([]byte("a.b")) || reg.Match([]byte("axb")) || reg.Match([]byte("catdog")) {
+		t.Error("[", reg.RE, "]\n", errors.New("list param does not match expected result"))
+	}
+
+	if Comp(`^%{1:list}$`, ParamList()).Match([]byte("")) {
+		t.Error("[", `%{1:list}`, "]\n", errors.New("empty list param should never match"))
+	}
+
+	reg = Comp(`^[a%{1:class}]+$`, `-]^\`)
+	if !reg.Match([]byte(`a-]^\`)) || reg.Match([]byte("b")) {
+		t.Error("[", reg.RE, "]\n", errors.New("class param does not match expected result"))
+	}
+
+	reg = Comp(`^%{1:raw}%2$`, `\d+`, `.`)
+	if !reg.Match([]byte("123.")) || reg.Match([]byte("123x")) {
+		t.Error("[", reg.RE, "]\n", errors.New("raw param does not match expected result"))
+	}
+
+	reg = CompNamed(`^%{word:list}\s%{word}$`, map[string]string{"word": ParamList("a", "b")})
+	if !reg.Match([]byte("a a\x00b")) || reg.Match([]byte("a a|b")) || reg.Match([]byte("a a")) {
+		t.Error("[", reg.RE, "]\n", errors.New("named param modifiers do not match expected result"))
+	}
+
+	// only the list modifier splits a param on NUL bytes
+	for _, re := range []string{`^%1$`, `^%{1:raw}$`} {
+		reg = Comp(re, "a\x00b")
+		if !reg.Match([]byte("a\x00b")) || reg.Match([]byte("a|b")) || reg.Match([]byte("a")) {
+			t.Error("[", reg.RE, "]\n", errors.New("param with a NUL byte does not match expected result"))
+		}
+	}
+	reg = Comp(`^[%{1:class}]$`, "a\x00b")
+	if !reg.Match([]byte{0}) || reg.Match([]byte("|")) {
+		t.Error("[", reg.RE, "]\n", errors.New("class param with a NUL byte does not match expected result"))
+	}
+
+	// a class with only an empty class param never matches, or matches anything if it is negated
+	reg = Comp(`^[%{1:class}]a]$`, "")
+	if reg.Match([]byte("a]")) || reg.Match([]byte("]")) || reg.Match([]byte("")) {
+		t.Error("[", reg.RE, "]\n", errors.New("empty class param should never match"))
+	}
+	reg = Comp(`^[^%{1:class}]a]$`, "")
+	if !reg.Match([]byte("xa]")) || reg.Match([]byte("a]")) {
+		t.Error("[", reg.RE, "]\n", errors.New("empty negated class param should match any char"))
+	}
+	reg = Comp(`^[a%{1:class}]$`, "")
+	if !reg.Match([]byte("a")) || reg.Match([]byte("b")) {
+		t.Error("[", reg.RE, "]\n", errors.New("empty class param does not match expected result"))
+	}
+}
+
+func TestDefine(t *testing.T) {
+	if err := Define("TEST_OCTET", `\d{1,3}`); err != nil {
+		t.Error("[", "TEST_OCTET", "]\n", err)
+	}
+	if err := Define("TEST_IP", `%{TEST_OCTET}(?:\.%{TEST_OCTET}){3}`); err != nil {
+		t.Error("[", "TEST_IP", "]\n", err)
+	}
+
+	reg := Comp(`^%{TEST_IP:client} \%{TEST_IP}$`)
+	m := reg.FindStringSubmatch("10.0.0.1 %{TEST_IP}")
+	if m == nil || m[reg.SubexpIndex("client")] != "10.0.0.1" || reg.Match([]byte("10.0.0 %{TEST_IP}")) {
+		t.Error("[", reg.RE, "]\n", errors.New("defined pattern does not match expected result"))
+	}
+
+	if err := Define("TEST_OCTET", `%{TEST_IP}`); !errors.Is(err, ErrPatternCycle) {
+		t.Error("[", "TEST_OCTET", "]\n", errors.New("pattern cycle did not return an error"))
+	}
+	if err := Define("TEST_SELF", `a%{TEST_SELF:x}`); !errors.Is(err, ErrPatternCycle) {
+		t.Error("[", "TEST_SELF", "]\n", errors.New("pattern cycle did not return an error"))
+	}
+	if err := Define("test", `a`); !errors.Is(err, ErrPatternName) {
+		t.Error("[", "test", "]\n", errors.New("invalid pattern name did not return an error"))
+	}
+
+	// redefining a pattern should not keep the old expansion in the cache
+	Define("TEST_OCTET", `[0-9]`)
+	if Comp(`^%{TEST_IP}$`).Match([]byte("10.0.0.1")) {
+		t.Error("[", "TEST_OCTET", "]\n", errors.New("redefined pattern was not used"))
+	}
+
+	// a named param takes precedence over a pattern with the same name
+	if reg, err := CompNamedTry(`^%{TEST_OCTET}$`, map[string]string{"TEST_OCTET": "x.y"}); err != nil || !reg.Match([]byte("x.y")) || reg.Match([]byte("1")) {
+		t.Error("[", reg.RE, "]\n", errors.New("named param did not take precedence over the defined pattern"), err)
+	}
+	if reg := Comp(`^%{TEST_OCTET}$`); !reg.Match([]byte("1")) {
+		t.Error("[", reg.RE, "]\n", errors.New("defined pattern was not used after a named param with the same name"))
+	}
+
+	// a param modifier is not a field name, so %{TEST_OCTET:list} is a named param, and not the pattern
+	if reg, err := CompNamedTry(`^%{TEST_OCTET:list}$`, map[string]string{"TEST_OCTET": ParamList("x.y", "z")}); err != nil || !reg.Match([]byte("z")) || reg.Match([]byte("1")) {
+		t.Error("[", reg.RE, "]\n", errors.New("param modifier was used as a field name"), err)
+	}
+	if _, err := CompNamedTry(`^%{TEST_OCTET:raw}$`, map[string]string{}); !errors.Is(err, ErrMissingParam) {
+		t.Error("[", `^%{TEST_OCTET:raw}$`, "]\n", errors.New("param modifier was used as a field name"), err)
+	}
+
+	name := filepath.Join(t.TempDir(), "patterns")
+	os.WriteFile(name, []byte("# comment\n\nTEST_KEY\t[a-z]+\nTEST_PAIR %{TEST_KEY:key}=%{TEST_VAL:val}\nTEST_VAL \\d+\n"), 0640)
+	if err := DefineFile(name); err != nil {
+		t.Error("[", name, "]\n", err)
+	}
+	if m := Comp(`%{TEST_PAIR}`).FindStringSubmatch("a=1 ab=12"); len(m) != 3 || m[1] != "a" || m[2] != "1" {
+		t.Error("[", m, "]\n", errors.New("patterns from file do not match expected result"))
+	}
+
+	os.WriteFile(name, []byte("TEST_A a\nTEST_B\n"), 0640)
+	if err := DefineFile(name); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Error("[", err, "]\n", errors.New("invalid pattern file did not return an error with the line number"))
+	}
+}
+
+func TestClassUnicode(t *testing.T) {
+	reg := Comp(`^[éa-zÀ]+$`)
+	if !reg.Match([]byte("éaÀz")) || reg.Match([]byte("ü")) || reg.Match([]byte{0xc3}) {
+		t.Error("[", reg.RE, "]\n", errors.New("multibyte class does not match expected result"))
+	}
+
+	reg = Comp(`^[ü-ÿ\x{100}-\x{17F}a😀]+$`)
+	if !reg.Match([]byte("üÿĀſa😀")) || reg.Match([]byte("é")) || reg.Match([]byte("b")) {
+		t.Error("[", reg.RE, "]\n", errors.New("multibyte ranges do not match expected result"))
+	}
+
+	// sorting the class should not create a range, or negate it
+	for _, test := range [][3]string{
+		{`^[z\-a-]+$`, "z-a", "b"},
+		{`^[.-]+$`, ".-", ","},
+		{`^[z^]+$`, "z^", "a"},
+		{`^[\pL-]+$`, "a-é", "1"},
+		{`^[a%1]+$`, "a-q", "b"},
+	} {
+		reg := Comp(test[0], "q-")
+		if !reg.Match([]byte(test[1])) || reg.Match([]byte(test[2])) {
+			t.Error("[", test[0], reg.RE, "]\n", errors.New("sorted class does not match expected result"))
+		}
+	}
+}
+
+func TestClassParser(t *testing.T) {
+	// classes the parser does not need to sort should be left byte for byte the same
+	for _, re := range []string{
+		`[[:alpha:]]`,
+		`[[:^space:]_]`,
+		`[\p{Lu}\d]`,
+		`[\pL-]`,
+		`[]a]`,
+		`[^]a]`,
+		`\[b-a\]`,
+		`[\]ab]c]`,
+		`\Q[b-a]\E`,
+		`[a-z][`,
+	} {
+		if res := compRE(re, nil); res != re {
+			t.Error("[", re, res, "]\n", errors.New("class was changed"))
+		}
+	}
+
+	if res := compRE(`[cb-da]`, nil); res != `[b-dac]` {
+		t.Error("[", `[cb-da]`, res, "]\n", errors.New("class was not sorted"))
+	}
+
+	for _, test := range [][3]string{
+		{`^[[:digit:]a]+$`, "1a2", "b"},
+		{`^[]a]+$`, "a]a", "b"},
+		{`^[^]a]+$`, "bc", "]"},
+		{`^\[[b]\]$`, "[b]", "b"},
+		{`^[\p{Lu}\d]+$`, "A1", "a"},
+	} {
+		reg := Comp(test[0])
+		if !reg.Match([]byte(test[1])) || reg.Match([]byte(test[2])) {
+			t.Error("[", test[0], reg.RE, "]\n", errors.New("class does not match expected result"))
+		}
+	}
+}
+
+func TestClassSet(t *testing.T) {
+	if res := compRE(`[a-z--[aeiou]]`, nil); res != `[b-df-hj-np-tv-z]` {
+		t.Error("[", `[a-z--[aeiou]]`, res, "]\n", errors.New("class subtraction was not expanded"))
+	}
+
+	for _, test := range [][3]string{
+		{`^[a-z--[aeiou]]+$`, "bcd", "bad"},
+		{`^[\w&&[^\d]]+$`, "a_B", "a1"},
+		{`^[a-c||[x-z]]+$`, "axcz", "d"},
+		{`^[^a-z--[aeiou]]+$`, "aeB", "b"},
+		{`^[a-z--[b-y&&[c-e]]]+$`, "abfz", "d"},
+		{`^[\p{L}--[a-zA-Z]]+$`, "éÀ", "a"},
+		{`^x[a--[a]]?$`, "x", "xa"},
+		{`^[\w--[_]]+$`, "aZ9", "a_"},
+		{`^[^\d||[a-f]]+$`, "xyz", "a"},
+		{`^[\s&&[^\n]]$`, " ", "\n"},
+	} {
+		reg := Comp(test[0])
+		if !reg.Match([]byte(test[1])) || reg.Match([]byte(test[2])) {
+			t.Error("[", test[0], reg.RE, "]\n", errors.New("class set does not match expected result"))
+		}
+	}
+
+	// a - without a nested class is not a set operation
+	if res := compRE(`[!--]`, nil); res != `[!--]` {
+		t.Error("[", `[!--]`, res, "]\n", errors.New("class range was changed"))
+	}
+
+	// a posix class is not a nested class
+	for _, re := range []string{`[0-9||[:digit:]]`, `[\w&&[:alpha:]]`, `[a-z--[:digit:]]`} {
+		if res := compRE(re, nil); res != re {
+			t.Error("[", re, res, "]\n", errors.New("class with a posix class was changed"))
+		}
+	}
+
+	// the value of a param is not known when the class is expanded, so the set operation cannot be expanded
+	for _, re := range []string{`[%1--[a]]`, `x[^%{1:class}&&[a-z]]`} {
+		_, err := CompTry(re, "b")
+		var cerr *CompileError
+		if !errors.Is(err, ErrClassSet) || !errors.As(err, &cerr) || cerr.Offset != strings.IndexByte(re, '[') {
+			t.Error("[", re, err, "]\n", errors.New("class set with a param did not return ErrClassSet"))
+		}
+	}
+	if IsValid(`[%1--[a]]`) {
+		t.Error("[", `[%1--[a]]`, "]\n", errors.New("class set with a param is valid"))
+	}
+
+	// the chars of \w depend on the UCP option with pcre, so the engine has to decide which chars it matches
+	expected := `[0-9A-Za-z]`
+	if EngineName == "pcre" {
+		expected = `(?:(?![_])[\w])`
+	}
+	if res := compRE(`[\w--[_]]`, nil); res != expected {
+		t.Error("[", `[\w--[_]]`, res, "]\n", errors.New("class subtraction does not match expected result"))
+	}
+}
+
+func TestCompRaw(t *testing.T) {
+	reg := CompRaw(`^a%1[ba]$`)
+	if !reg.Match([]byte("a%1b")) || reg.Match([]byte("ab")) {
+		t.Error("[", reg.RE, "]\n", errors.New("raw regex was changed before compiling"))
+	}
+
+	// the expanded regex of Comp(`[ba]`) is [ab], which should not share a cache entry with the raw regex
+	if CompRaw(`[ab]`) == Comp(`[ba]`) || CompRaw(`[ab]`) != CompRaw(`[ab]`) {
+		t.Error("[", `[ab]`, "]\n", errors.New("raw regex should be cached separately"))
+	}
+
+	_, err := CompRawTry(`a(b`)
+	if cerr, ok := err.(*CompileError); !ok || cerr.Pattern != `a(b` || cerr.Expanded != `a(b` {
+		t.Error("[", err, "]\n", errors.New("raw regex did not return a compile error"))
+	}
+}
+
+func TestRegisterSyntax(t *testing.T) {
+	t.Cleanup(resetSyntax)
+
+	// the result of a pattern that was expanded before the token was registered should not be used from the cache
+	if res := compRE(`^a\y$`, nil); res != `^a\y$` {
+		t.Error("[", res, "]\n", errors.New("token was replaced before it was registered"))
+	}
+
+	if err := RegisterSyntax(`\(\?env:(\w+)\)`, func(data func(int) []byte) []byte {
+		return []byte(Escape(os.Getenv(string(data(1)))))
+	}); err != nil {
+		t.Error("[", `(?env:NAME)`, "]\n", err)
+	}
+
+	// tokens are replaced in the order they were registered, so the result of this token is not replaced by (?env:NAME)
+	if err := RegisterSyntax(`\\y`, func(data func(int) []byte) []byte {
+		return []byte(`(?env:REGEX_TEST_SYNTAX)`)
+	}); err != nil {
+		t.Error("[", `\y`, "]\n", err)
+	}
+
+	os.Setenv("REGEX_TEST_SYNTAX", "b.c")
+	defer os.Unsetenv("REGEX_TEST_SYNTAX")
+
+	if res := compRE(`^a\y$`, nil); res != `^a(?env:REGEX_TEST_SYNTAX)$` {
+		t.Error("[", res, "]\n", errors.New("token should only be replaced by the tokens registered after it"))
+	}
+
+	reg := Comp(`^a(?env:REGEX_TEST_SYNTAX)[ed]$`)
+	if !reg.Match([]byte("ab.cd")) || reg.Match([]byte("abxcd")) {
+		t.Error("[", reg.RE, "]\n", errors.New("token was not replaced"))
+	}
+
+	// the expanded pattern is cached, so the token keeps the value it had the first time
+	os.Setenv("REGEX_TEST_SYNTAX", "x")
+	if reg := Comp(`^a(?env:REGEX_TEST_SYNTAX)[ed]$`); !reg.Match([]byte("ab.cd")) {
+		t.Error("[", reg.RE, "]\n", errors.New("token was replaced again for a cached pattern"))
+	}
+	os.Setenv("REGEX_TEST_SYNTAX", "b.c")
+
+	if res := compRE(`\(?env:REGEX_TEST_SYNTAX)|\\(?env:REGEX_TEST_SYNTAX)`, nil); res != `\(?env:REGEX_TEST_SYNTAX)|\\b\.c` {
+		t.Error("[", res, "]\n", errors.New("escaped token should not be replaced"))
+	}
+
+	if err := RegisterSyntax(`a*`, nil); !errors.Is(err, ErrSyntaxToken) {
+		t.Error("[", err, "]\n", errors.New("token that matches an empty string should not be registered"))
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	// a log line checked against a list of alert patterns
+	re := make([]string, 300)
+	for i := range re {
+		switch i % 3 {
+		case 0:
+			re[i] = `error code ` + strconv.Itoa(1000+i) + `\b`
+		case 1:
+			re[i] = `warn(?:ing)?: user` + strconv.Itoa(i) + ` \w+`
+		default:
+			re[i] = `(?i)service ` + strconv.Itoa(i) + ` (?:down|failed)`
+		}
+	}
+	str := []byte("2024-01-02 10:11:12 host app[123]: warning: user151 logged in from 10.0.0.1, error code 1297 on service 20 failed")
+
+	set := CompSet(re)
+	for i := 0; i < b.N; i++ {
+		set.Matches(str)
+	}
+}
@@ -0,0 +1,78 @@
+package regex
+
+import (
+	"fmt"
+)
+
+// Set is a list of regex that can be matched against the same input together
+//
+// each regex is run separately.
+// note: a single regex with a lookahead for each pattern was slower, because pcre cannot skip ahead to a likely start of a match inside a lookahead
+type Set struct {
+	list []*Regexp
+}
+
+// CompSet compiles a list of regex into a Set
+//
+// each regex goes through the same preprocessing and cache as Comp, with the same params
+func CompSet(re []string, params ...string) *Set {
+	set, err := CompSetTry(re, params...)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// CompSetTry tries to compile a list of regex into a Set or returns an error
+//
+// the error includes the index of the first regex that failed to compile
+func CompSetTry(re []string, params ...string) (*Set, error) {
+	set := Set{list: make([]*Regexp, len(re))}
+
+	for i, r := range re {
+		reg, err := CompTry(r, params...)
+		if err != nil {
+			return &Set{}, fmt.Errorf("regex: set pattern %d: %w", i, err)
+		}
+		set.list[i] = reg
+	}
+
+	return &set, nil
+}
+
+// Len returns the number of regex in the Set
+func (set *Set) Len() int {
+	return len(set.list)
+}
+
+// Match returns true if any regex in the Set matches a byte array
+func (set *Set) Match(str []byte) bool {
+	for _, reg := range set.list {
+		if reg.Match(str) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns the index of every regex in the Set that matches a byte array, in order
+func (set *Set) Matches(str []byte) []int {
+	res := []int{}
+	for i, reg := range set.list {
+		if reg.Match(str) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// MatchIndex returns the start and end index of the first match of each regex in the Set
+//
+// the result has the same length as the Set, and the value is nil for a regex that did not match
+func (set *Set) MatchIndex(str []byte) [][]int {
+	res := make([][]int, len(set.list))
+	for i, reg := range set.list {
+		res[i] = reg.FindIndex(str)
+	}
+	return res
+}
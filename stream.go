@@ -0,0 +1,256 @@
+package regex
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// repWriterChunk is the number of bytes read in between each scan of a RepWriter buffer
+const repWriterChunk = 32 * 1024
+
+// RepWriter is an io.WriteCloser that replaces regex matches in everything written to it,
+// and writes the result to another io.Writer
+//
+// only a sliding window of the input is held in memory, so matches that cross
+// the boundary between two writes are still found, as long as they are not longer than the max match size
+//
+// Close must be called to flush the end of the input
+type RepWriter struct {
+	reg *Regexp
+	w io.Writer
+	rep func(data func(int) []byte) []byte
+
+	// maxSize is the max length of a match (0 for no limit)
+	maxSize int
+	// once stops replacing after the first match
+	once bool
+	// found is true once a match has been replaced
+	found bool
+
+	buf []byte
+	next int
+	// ctx is the number of bytes at the start of buf that were already written, and are only kept as context for the next match
+	ctx int
+	abut bool
+	done bool
+	err error
+}
+
+// NewRepWriter returns a RepWriter that replaces matches with a string, in the same way as RepStr
+//
+// @maxReSize: the max length of a match in bytes (default: 10 times the length of the regex, with a min of 1024).
+// if set to 0 or less, there is no limit, and the input is buffered until a match can be finished
+func (reg *Regexp) NewRepWriter(w io.Writer, rep []byte, maxReSize ...int64) *RepWriter {
+	return reg.NewRepWriterFunc(w, func(data func(int) []byte) []byte {
+		return reg.expand(rep, data)
+	}, maxReSize...)
+}
+
+// NewRepWriterFunc returns a RepWriter that replaces matches with the result of a function, in the same way as RepFunc
+//
+// if the function returns nil, the current match is removed and the rest of the input is written unchanged
+//
+// @maxReSize: the max length of a match in bytes (default: 10 times the length of the regex, with a min of 1024).
+// if set to 0 or less, there is no limit, and the input is buffered until a match can be finished
+func (reg *Regexp) NewRepWriterFunc(w io.Writer, rep func(data func(int) []byte) []byte, maxReSize ...int64) *RepWriter {
+	size := int(reg.len * 10)
+	if size < 1024 {
+		size = 1024
+	}
+	if len(maxReSize) != 0 {
+		size = int(maxReSize[0])
+		if size < 0 {
+			size = 0
+		}
+	}
+
+	return &RepWriter{
+		reg: reg,
+		w: w,
+		rep: rep,
+		maxSize: size,
+		next: size + repWriterChunk,
+	}
+}
+
+// RepReader copies an io.Reader to an io.Writer, and replaces matches with a string, in the same way as RepStr
+//
+// @maxReSize: the max length of a match in bytes (see NewRepWriter)
+func (reg *Regexp) RepReader(r io.Reader, w io.Writer, rep []byte, maxReSize ...int64) error {
+	rw := reg.NewRepWriter(w, rep, maxReSize...)
+	if _, err := io.Copy(rw, r); err != nil {
+		return err
+	}
+	return rw.Close()
+}
+
+// RepReaderFunc copies an io.Reader to an io.Writer, and replaces matches with the result of a function, in the same way as RepFunc
+//
+// @maxReSize: the max length of a match in bytes (see NewRepWriter)
+func (reg *Regexp) RepReaderFunc(r io.Reader, w io.Writer, rep func(data func(int) []byte) []byte, maxReSize ...int64) error {
+	rw := reg.NewRepWriterFunc(w, rep, maxReSize...)
+	if _, err := io.Copy(rw, r); err != nil {
+		return err
+	}
+	return rw.Close()
+}
+
+// Write adds to the input, and writes any part of the result that can no longer change
+func (rw *RepWriter) Write(p []byte) (int, error) {
+	if rw.err != nil {
+		return 0, rw.err
+	}
+
+	size := len(p)
+	for len(p) != 0 {
+		n := rw.next - len(rw.buf)
+		if n < 1 {
+			n = 1
+		}else if n > len(p) {
+			n = len(p)
+		}
+
+		rw.buf = append(rw.buf, p[:n]...)
+		p = p[n:]
+
+		if len(rw.buf) >= rw.next {
+			if err := rw.flush(false); err != nil {
+				return size - len(p), err
+			}
+		}
+	}
+
+	return size, nil
+}
+
+// Close writes the rest of the result
+//
+// note: the underlying io.Writer is not closed
+func (rw *RepWriter) Close() error {
+	if rw.err != nil {
+		return rw.err
+	}
+	return rw.flush(true)
+}
+
+// flush replaces the matches in the buffer, and writes the part of the result that can no longer change
+//
+// @final: if true, the buffer is the end of the input, and all of it will be written
+func (rw *RepWriter) flush(final bool) error {
+	data := rw.buf
+	n := len(data)
+
+	// leave an incomplete utf8 char at the end of the buffer for the next write
+	if !final {
+		for i := n-1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					n = i
+				}
+				break
+			}
+		}
+	}
+
+	safe := -1
+	if !final && rw.maxSize > 0 {
+		safe = n - rw.maxSize
+	}
+
+	out := []byte{}
+	last := rw.ctx
+	pending := -1
+	lastEnd := -1
+	if rw.abut {
+		lastEnd = rw.ctx
+	}
+
+	offset := rw.ctx
+	checked := false
+	for !rw.done && offset <= n {
+		ind, partial, err := rw.reg.match(data[:n], offset, !final, checked)
+		if err != nil {
+			rw.err = err
+			return err
+		}else if ind == nil {
+			break
+		}
+		checked = true
+
+		if !final && (partial || !canPartial) && (safe == -1 || ind[0] >= safe) {
+			// this match may change with more input
+			pending = ind[0]
+			break
+		}
+
+		if partial {
+			// this match is already longer than the max match size, so continue looking after it
+			_, size := utf8.DecodeRune(data[ind[0]:n])
+			offset = ind[0] + size
+			continue
+		}
+
+		if ind[0] != ind[1] || ind[0] != lastEnd {
+			out = append(out, data[last:ind[0]]...)
+			last = ind[1]
+			rw.found = true
+
+			r := rw.rep(groupData(data, ind))
+			if r == nil {
+				rw.done = true
+			}else{
+				out = append(out, r...)
+			}
+
+			if rw.once {
+				rw.done = true
+			}
+		}
+		lastEnd = ind[1]
+
+		offset = nextOffset(data[:n], ind)
+	}
+
+	keep := n
+	if final || rw.done {
+		keep = len(data)
+	}else if !canPartial {
+		// without partial matching, a match could still start anywhere within the max match size of the end of the buffer
+		keep = last
+		if safe > last {
+			keep = safe
+		}
+	}else if pending != -1 {
+		keep = pending
+	}
+
+	out = append(out, data[last:keep]...)
+	if len(out) != 0 {
+		if _, err := rw.w.Write(out); err != nil {
+			rw.err = err
+			return err
+		}
+	}
+
+	rw.abut = lastEnd == keep && last == keep
+
+	// the last chars that were written are kept as context for the next match, so lookbehinds, \b and ^ can see them
+	chars := rw.reg.lookbehind()
+	if chars < 1 {
+		chars = 1
+	}
+	rw.ctx = 0
+	for i := 0; i < chars && rw.ctx < keep; i++ {
+		_, size := utf8.DecodeLastRune(data[:keep-rw.ctx])
+		rw.ctx += size
+	}
+	rw.buf = append(rw.buf[:0], data[keep-rw.ctx:]...)
+	rw.next = len(rw.buf) + repWriterChunk
+	if rw.maxSize > 0 && rw.next < rw.maxSize + repWriterChunk {
+		rw.next = rw.maxSize + repWriterChunk
+	}else if rw.maxSize == 0 {
+		rw.next = len(rw.buf) * 2 + repWriterChunk
+	}
+
+	return nil
+}
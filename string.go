@@ -0,0 +1,153 @@
+package regex
+
+import (
+	"context"
+	"unsafe"
+)
+
+//* string methods
+
+// bytesOf returns the bytes of a string without copying them
+//
+// the result shares memory with the string, and must never be modified
+func bytesOf(s string) []byte {
+	if s == "" {
+		return []byte{}
+	}
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		Cap int
+	}{s, len(s)}))
+}
+
+// MatchString returns true if a string matches the regex
+func (reg *Regexp) MatchString(str string) bool {
+	return reg.Match(bytesOf(str))
+}
+
+// RepStrString replaces a string with another string
+//
+// @rep uses the same syntax as RepStr ($1, ${12}, ${name})
+func (reg *Regexp) RepStrString(str string, rep string) string {
+	return string(reg.RepStr(bytesOf(str), bytesOf(rep)))
+}
+
+// RepStrLitString replaces a string with another string
+//
+// note: the replacement string does not accept replacements like $1
+func (reg *Regexp) RepStrLitString(str string, rep string) string {
+	return string(reg.RepStrLit(bytesOf(str), bytesOf(rep)))
+}
+
+// RepFuncString replaces a string with the result of a function
+//
+// similar to RepFunc, but the capture groups are strings, and the loop cannot be stopped early
+func (reg *Regexp) RepFuncString(str string, rep func(data func(int) string) string) string {
+	b := bytesOf(str)
+	res, _ := reg.repFunc(context.Background(), b, func(ind []int) []byte {
+		return bytesOf(rep(func(g int) string {
+			if g*2+1 < len(ind) && ind[g*2] >= 0 {
+				return str[ind[g*2]:ind[g*2+1]]
+			}
+			return ""
+		}))
+	}, false)
+	return string(res)
+}
+
+// SplitString splits a string, and keeps capture groups
+//
+// the parts are substrings of @str, so no extra copies are made
+func (reg *Regexp) SplitString(str string) []string {
+	ind, _ := reg.splitIndex(context.Background(), bytesOf(str))
+	return matchStrings(str, ind)
+}
+
+// FindStringIndex returns the start and end index of the first match, or nil if there is no match
+func (reg *Regexp) FindStringIndex(str string) []int {
+	return reg.FindIndex(bytesOf(str))
+}
+
+// FindString returns the first match of the regex, or an empty string if there is no match
+func (reg *Regexp) FindString(str string) string {
+	if pos := reg.FindStringIndex(str); pos != nil {
+		return str[pos[0]:pos[1]]
+	}
+	return ""
+}
+
+// FindStringSubmatchIndex returns the index pairs of the first match and its capture groups, or nil if there is no match
+func (reg *Regexp) FindStringSubmatchIndex(str string) []int {
+	return reg.FindSubmatchIndex(bytesOf(str))
+}
+
+// FindStringSubmatch returns the first match and its capture groups, or nil if there is no match
+//
+// a capture group that did not participate in the match is an empty string
+func (reg *Regexp) FindStringSubmatch(str string) []string {
+	if ind := reg.FindStringSubmatchIndex(str); ind != nil {
+		return subMatchStrings(str, ind)
+	}
+	return nil
+}
+
+// FindAllStringIndex returns the start and end index of every match
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllStringIndex(str string, n int) [][]int {
+	return reg.FindAllIndex(bytesOf(str), n)
+}
+
+// FindAllString returns every match of the regex
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllString(str string, n int) []string {
+	return matchStrings(str, reg.FindAllStringIndex(str, n))
+}
+
+// FindAllStringSubmatchIndex returns the index pairs of every match and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllStringSubmatchIndex(str string, n int) [][]int {
+	return reg.FindAllSubmatchIndex(bytesOf(str), n)
+}
+
+// FindAllStringSubmatch returns every match of the regex and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllStringSubmatch(str string, n int) [][]string {
+	ind := reg.FindAllStringSubmatchIndex(str, n)
+	if ind == nil {
+		return nil
+	}
+
+	res := make([][]string, len(ind))
+	for i, pos := range ind {
+		res[i] = subMatchStrings(str, pos)
+	}
+	return res
+}
+
+// matchStrings converts a list of match indexes into a list of substrings
+func matchStrings(str string, ind [][]int) []string {
+	if ind == nil {
+		return nil
+	}
+
+	res := make([]string, len(ind))
+	for i, pos := range ind {
+		res[i] = str[pos[0]:pos[1]]
+	}
+	return res
+}
+
+// subMatchStrings converts a list of group index pairs into a list of substrings
+func subMatchStrings(str string, ind []int) []string {
+	res := make([]string, len(ind)/2)
+	for i := range res {
+		if ind[i*2] >= 0 {
+			res[i] = str[ind[i*2]:ind[i*2+1]]
+		}
+	}
+	return res
+}
@@ -0,0 +1,124 @@
+package regex
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// ErrSyntaxToken is returned by RegisterSyntax when a token is not valid
+var ErrSyntaxToken error = errors.New("regex: invalid syntax token")
+
+// syntaxRule is a custom token added by RegisterSyntax
+type syntaxRule struct {
+	re *regexp.Regexp
+	rep func(data func(int) []byte) []byte
+}
+
+var syntaxMU sync.RWMutex
+var syntaxList []syntaxRule
+
+// syntaxKey is added to the preprocessor cache key, so a regex is expanded again after the list of tokens changes
+var syntaxKey string
+var syntaxVersion int
+
+// RegisterSyntax adds a custom token to the extended syntax of Comp
+//
+//	regex.RegisterSyntax(`\\h`, func(data func(int) []byte) []byte {
+//		return []byte(`[\w-]+(?:\.[\w-]+)*`)
+//	})
+//
+//	regex.RegisterSyntax(`\(\?env:(\w+)\)`, func(data func(int) []byte) []byte {
+//		return []byte(regex.Escape(os.Getenv(string(data(1)))))
+//	})
+//
+// @token: a regex (using the RE2 syntax of the regexp package) that matches the token in a pattern
+//
+// @rep: returns the regex that replaces the token. data(0) is the full token, and data(1) and up are its capture groups
+//
+// tokens are replaced after defined patterns (%{NAME}) are expanded, and comments and \' are replaced,
+// but before [...] classes are sorted and params (%1) are replaced.
+// each token is replaced in the order it was registered, so a token can be used in the result of a token registered before it.
+// a token with an unescaped \ before it (like \\h) is not replaced.
+//
+// the expanded pattern is cached, so @rep only runs the first time a pattern is compiled.
+// a token that depends on something that can change (like the (?env:NAME) example) keeps the value it had at that time
+func RegisterSyntax(token string, rep func(data func(int) []byte) []byte) error {
+	re, err := regexp.Compile(token)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSyntaxToken, err)
+	}
+
+	// a token that matches an empty string would be added between every char
+	if re.MatchString("") {
+		return fmt.Errorf("%w: %q matches an empty string", ErrSyntaxToken, token)
+	}
+
+	syntaxMU.Lock()
+	defer syntaxMU.Unlock()
+
+	syntaxList = append(syntaxList, syntaxRule{re: re, rep: rep})
+	syntaxVersion++
+	syntaxKey = "\x00syntax" + strconv.Itoa(syntaxVersion)
+
+	return nil
+}
+
+// resetSyntax removes all the tokens added by RegisterSyntax
+func resetSyntax() {
+	syntaxMU.Lock()
+	defer syntaxMU.Unlock()
+
+	syntaxList = nil
+	syntaxVersion++
+	syntaxKey = "\x00syntax" + strconv.Itoa(syntaxVersion)
+}
+
+// getSyntaxKey returns the part of the preprocessor cache key for the tokens added by RegisterSyntax
+func getSyntaxKey() string {
+	syntaxMU.RLock()
+	defer syntaxMU.RUnlock()
+	return syntaxKey
+}
+
+// expandSyntax replaces the tokens added by RegisterSyntax
+//
+// @srcMap: if not nil, a map of the offsets is kept in the same way as mappedReplace
+func expandSyntax(reB []byte, srcMap []int) ([]byte, []int) {
+	syntaxMU.RLock()
+	rules := syntaxList
+	syntaxMU.RUnlock()
+
+	for _, rule := range rules {
+		ind := [][]int{}
+		for _, pos := range rule.re.FindAllSubmatchIndex(reB, -1) {
+			if !isEscaped(reB, pos[0]) {
+				ind = append(ind, pos)
+			}
+		}
+		if len(ind) == 0 {
+			continue
+		}
+
+		src := reB
+		n := 0
+		reB, srcMap = mappedReplaceIndex(src, srcMap, ind, func(b []byte) []byte {
+			pos := ind[n]
+			n++
+			return rule.rep(groupData(src, pos))
+		})
+	}
+
+	return reB, srcMap
+}
+
+// isEscaped returns true if the char at @i has an odd number of \ before it
+func isEscaped(re []byte, i int) bool {
+	n := 0
+	for i-n > 0 && re[i-n-1] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
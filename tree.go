@@ -0,0 +1,225 @@
+package regex
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TreeOptions are the options used by RepTreeStr and RepTreeFunc
+type TreeOptions struct {
+	// Include is a list of glob patterns (see filepath.Match) for the files to modify
+	//
+	// a pattern can match the name of a file, or its path relative to the root.
+	// if empty, every file is included
+	Include []string
+
+	// Exclude is a list of glob patterns for the files and directories to skip
+	//
+	// a pattern can match the name of a file or directory, or its path relative to the root
+	Exclude []string
+
+	// MaxDepth is the max number of directories to walk into (0 for no limit)
+	//
+	// a MaxDepth of 1 will only modify the files directly inside the root directory
+	MaxDepth int
+
+	// FollowSymlinks will follow symlinks to files and directories
+	//
+	// if false, symlinks are skipped
+	FollowSymlinks bool
+
+	// DryRun will only report the changes, without modifying any files
+	//
+	// in this mode, each TreeChange includes a unified diff of the change
+	DryRun bool
+}
+
+// TreeChange is a summary of the changes made to a single file by RepTreeStr or RepTreeFunc
+type TreeChange struct {
+	// Path is the path of the file, joined with the root
+	Path string
+
+	// Matches is the number of matches that were replaced
+	Matches int
+
+	// Diff is a unified diff of the change (only set in DryRun mode)
+	Diff string
+
+	// Err is the error returned while reading or writing this file
+	Err error
+}
+
+// RepTreeStr replaces a string with another string in every file in a directory tree
+//
+// @rep uses the same syntax as RepStr ($1, ${12}, ${name})
+//
+// only files with at least one match are included in the result.
+// if any file returns an error, the walk continues, and the first error is returned at the end
+func (reg *Regexp) RepTreeStr(root string, rep []byte, opts TreeOptions) ([]TreeChange, error) {
+	return reg.repTree(root, func(data func(int) []byte) []byte {
+		return reg.expand(rep, data)
+	}, opts)
+}
+
+// RepTreeFunc replaces a regex match with the result of a callback function in every file in a directory tree
+//
+// the callback is run in the same way as RepFunc, but returning nil only removes the match (it does not stop the loop)
+//
+// only files with at least one match are included in the result.
+// if any file returns an error, the walk continues, and the first error is returned at the end
+func (reg *Regexp) RepTreeFunc(root string, rep func(data func(int) []byte) []byte, opts TreeOptions) ([]TreeChange, error) {
+	return reg.repTree(root, rep, opts)
+}
+
+// repTree walks a directory tree, and replaces the matches in each file that matches the options
+func (reg *Regexp) repTree(root string, rep func(data func(int) []byte) []byte, opts TreeOptions) ([]TreeChange, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	w := treeWalker{reg: reg, rep: rep, opts: opts, seen: map[string]bool{}, res: []TreeChange{}}
+
+	if !stat.IsDir() {
+		w.file(root, filepath.Base(root))
+	}else{
+		w.dir(root, "", 1)
+	}
+
+	return w.res, w.err
+}
+
+// treeWalker holds the state of a single RepTree call
+type treeWalker struct {
+	reg *Regexp
+	rep func(data func(int) []byte) []byte
+	opts TreeOptions
+
+	// seen holds the real path of every file and directory that was visited, so symlinks cannot cause loops
+	seen map[string]bool
+
+	res []TreeChange
+	err error
+}
+
+// dir walks a directory
+//
+// @rel: the path relative to the root
+//
+// @depth: the depth of the files in this directory (1 for the files in the root)
+func (w *treeWalker) dir(name string, rel string, depth int) {
+	if real, err := filepath.EvalSymlinks(name); err == nil {
+		if w.seen[real] {
+			return
+		}
+		w.seen[real] = true
+	}
+
+	list, err := os.ReadDir(name)
+	if err != nil {
+		w.fail(TreeChange{Path: name, Err: err})
+		return
+	}
+
+	for _, entry := range list {
+		path := filepath.Join(name, entry.Name())
+		relPath := filepath.Join(rel, entry.Name())
+
+		if matchGlob(w.opts.Exclude, entry.Name(), relPath) {
+			continue
+		}
+
+		mode := entry.Type()
+		if mode&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+
+			stat, err := os.Stat(path)
+			if err != nil {
+				w.fail(TreeChange{Path: path, Err: err})
+				continue
+			}
+			mode = stat.Mode().Type()
+		}
+
+		if mode.IsDir() {
+			if w.opts.MaxDepth <= 0 || depth < w.opts.MaxDepth {
+				w.dir(path, relPath, depth+1)
+			}
+		}else if mode.IsRegular() {
+			w.file(path, relPath)
+		}
+	}
+}
+
+// file replaces the matches in a single file, or reports them in DryRun mode
+func (w *treeWalker) file(name string, rel string) {
+	if len(w.opts.Include) != 0 && !matchGlob(w.opts.Include, filepath.Base(name), rel) {
+		return
+	}
+
+	if real, err := filepath.EvalSymlinks(name); err == nil {
+		if w.seen[real] {
+			return
+		}
+		w.seen[real] = true
+	}
+
+	change := TreeChange{Path: name}
+	count := func(data func(int) []byte) []byte {
+		change.Matches++
+		if r := w.rep(data); r != nil {
+			return r
+		}
+		return []byte{}
+	}
+
+	if w.opts.DryRun {
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			change.Err = err
+			w.fail(change)
+			return
+		}
+
+		res := w.reg.RepFunc(buf, count)
+		if change.Matches != 0 {
+			change.Diff = unifiedDiff(filepath.ToSlash(rel), buf, res)
+			w.res = append(w.res, change)
+		}
+		return
+	}
+
+	if err := w.reg.repFile(name, count, true, nil); err == io.EOF {
+		return
+	}else if err != nil {
+		change.Err = err
+		w.fail(change)
+		return
+	}
+
+	w.res = append(w.res, change)
+}
+
+// fail adds a change with an error to the result, and keeps the first error
+func (w *treeWalker) fail(change TreeChange) {
+	w.res = append(w.res, change)
+	if w.err == nil {
+		w.err = change.Err
+	}
+}
+
+// matchGlob returns true if a file name, or its relative path, matches any glob pattern in a list
+func matchGlob(list []string, name string, rel string) bool {
+	for _, pattern := range list {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(filepath.FromSlash(pattern), rel); ok {
+			return true
+		}
+	}
+	return false
+}
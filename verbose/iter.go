@@ -0,0 +1,17 @@
+package regex
+
+//* regex iterator methods
+
+// AllFunc runs a callback with every match of the regex, in order
+//
+// returning false from @yield stops the search
+func (reg *Regexp) AllFunc(str []byte, yield func(match []byte) bool) {
+	reg.reg.AllFunc(str, yield)
+}
+
+// AllSubmatchesFunc runs a callback with the index pairs and values of every match and its capture groups, in order
+//
+// returning false from @yield stops the search
+func (reg *Regexp) AllSubmatchesFunc(str []byte, yield func(ind []int, match [][]byte) bool) {
+	reg.reg.AllSubmatchesFunc(str, yield)
+}
@@ -0,0 +1,21 @@
+//go:build go1.23
+
+package regex
+
+import (
+	"iter"
+)
+
+// All returns an iterator over every match of the regex
+//
+// breaking out of the loop stops the search
+func (reg *Regexp) All(str []byte) iter.Seq[[]byte] {
+	return reg.reg.All(str)
+}
+
+// AllSubmatches returns an iterator over the index pairs and values of every match and its capture groups
+//
+// breaking out of the loop stops the search
+func (reg *Regexp) AllSubmatches(str []byte) iter.Seq2[[]int, [][]byte] {
+	return reg.reg.AllSubmatches(str)
+}
@@ -1,20 +1,19 @@
 package regex
 
 import (
+	"context"
 	"io"
-	"os"
 	"regexp"
 
 	"github.com/AspieSoft/go-regex/v8"
 	"github.com/AspieSoft/go-regex/v8/common"
-	"github.com/GRbit/go-pcre"
 )
 
-type PCRE pcre.Regexp
+type PCRE = regex.PCRE
 type RE2 *regexp.Regexp
 
 type Regexp struct {
-	RE pcre.Regexp
+	RE regex.Engine
 	reg *regex.Regexp
 	len int64
 }
@@ -34,9 +33,179 @@ func CompileTry(re string, params ...string) (*Regexp, error) {
 	if err != nil {
 		return &Regexp{}, err
 	}
-	return &Regexp{RE: reg.RE, len: int64(len(re))}, nil
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}, nil
 }
 
+// CompileNamed compiles a regular expression with named params, and store it in the cache
+//
+// use %{name} to reference a param by its name (the values are escaped in the same way as Compile)
+//
+// a param takes precedence over a pattern added by Define with the same name
+//
+// this method will panic if a param in the regex has no value
+func CompileNamed(re string, params map[string]string) *Regexp {
+	reg := regex.CompNamed(re, params)
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}
+}
+
+// CompileNamedTry tries to compile a regular expression with named params or returns an error
+//
+// if a param in the regex has no value, the error matches regex.ErrMissingParam (with errors.Is)
+func CompileNamedTry(re string, params map[string]string) (*Regexp, error) {
+	reg, err := regex.CompNamedTry(re, params)
+	if err != nil {
+		return &Regexp{}, err
+	}
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}, nil
+}
+
+// CompileRaw compiles a regular expression without the extended syntax of Compile, and store it in the cache
+//
+// raw regex are cached separately, so a raw and an extended regex with the same text never share a cache entry
+func CompileRaw(re string) *Regexp {
+	reg := regex.CompRaw(re)
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}
+}
+
+// CompileRawTry tries to compile a regular expression without the extended syntax of Compile or returns an error
+func CompileRawTry(re string) (*Regexp, error) {
+	reg, err := regex.CompRawTry(re)
+	if err != nil {
+		return &Regexp{}, err
+	}
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}, nil
+}
+
+// Define adds a reusable pattern, that can be referenced by other patterns with %{NAME} or %{NAME:field}
+//
+// %{NAME} is expanded into a non-capturing group, and %{NAME:field} is expanded into a capture group named field
+// (raw, list and class are param modifiers, so they are not used as a field name)
+//
+// an error is returned if the name is not valid, or the pattern would reference itself
+func Define(name string, re string) error {
+	return regex.Define(name, re)
+}
+
+// DefineFile loads a list of patterns from a file, and adds them with Define
+//
+// each line has a name, followed by whitespace and the pattern (empty lines, and lines starting with #, are skipped)
+func DefineFile(path string) error {
+	return regex.DefineFile(path)
+}
+
+// RegisterSyntax adds a custom token to the extended syntax of Compile
+//
+// @token: a regex (using the RE2 syntax of the regexp package) that matches the token in a pattern
+//
+// @rep: returns the regex that replaces the token (data(0) is the full token, and data(1) and up are its capture groups)
+//
+// tokens are replaced in the order they were registered, after defined patterns and comments, and before classes and params
+func RegisterSyntax(token string, rep func(data func(int) []byte) []byte) error {
+	return regex.RegisterSyntax(token, rep)
+}
+
+// CompileError is returned by CompileTry (and the other compile methods) when a regex fails to compile
+//
+// the offset of the error is mapped back to the original pattern, before it was expanded
+type CompileError = regex.CompileError
+
+// Options are extra flags used to compile a regex with CompileOpts
+type Options = regex.Options
+
+// CompileOpts compiles a regular expression with extra compile options, and store it in the cache
+//
+// the options are part of the cache key, so the same regex can be cached with different options
+func CompileOpts(re string, opts Options, params ...string) *Regexp {
+	reg := regex.CompOpts(re, opts, params...)
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}
+}
+
+// CompileOptsTry tries to compile with extra compile options or returns an error
+func CompileOptsTry(re string, opts Options, params ...string) (*Regexp, error) {
+	reg, err := regex.CompOptsTry(re, opts, params...)
+	if err != nil {
+		return &Regexp{}, err
+	}
+	return &Regexp{RE: reg.RE, reg: reg, len: int64(len(re))}, nil
+}
+
+// Set is a list of regex that can be matched against the same input together
+//
+// each regex is run separately
+type Set = regex.Set
+
+// CompileSet compiles a list of regex into a Set
+//
+// each regex goes through the same preprocessing and cache as Compile, with the same params
+func CompileSet(re []string, params ...string) *Set {
+	return regex.CompSet(re, params...)
+}
+
+// CompileSetTry tries to compile a list of regex into a Set or returns an error
+func CompileSetTry(re []string, params ...string) (*Set, error) {
+	return regex.CompSetTry(re, params...)
+}
+
+// Report is the result of Analyze
+type Report = regex.Report
+
+// Issue is a part of a regex that is vulnerable to catastrophic backtracking
+type Issue = regex.Issue
+
+// Severity is the risk level of an Issue found by Analyze
+type Severity = regex.Severity
+
+// Analyze looks for parts of a regex that are vulnerable to catastrophic backtracking (ReDoS),
+// without compiling or running it
+func Analyze(re string, params ...string) Report {
+	return regex.Analyze(re, params...)
+}
+
+
+//* cache methods
+
+// Cache is used by Compile and CompileTry to store compiled regex
+//
+// each key can store either a compiled regex, or the error returned when it failed to compile
+type Cache = regex.Cache
+
+// NewLRUCache returns a Cache that removes the least recently used regex once it holds too many entries, or too many bytes
+//
+// @maxEntries: the max number of compiled regex to keep (0 for no limit)
+//
+// @maxBytes: the max estimated size of the compiled regex in bytes (0 for no limit)
+func NewLRUCache(maxEntries int, maxBytes int64) Cache {
+	return regex.NewLRUCache(maxEntries, maxBytes)
+}
+
+// SetCache changes the Cache used by Compile and CompileTry
+//
+// if @c is nil, a new default LRU cache will be used
+func SetCache(c Cache) {
+	regex.SetCache(c)
+}
+
+// CacheStats holds the stats of the compiled regex cache, and the compRE preprocessing cache
+type CacheStats = regex.CacheStats
+
+// CacheSnapshotList holds a list of the items in the compiled regex cache, and the compRE preprocessing cache
+type CacheSnapshotList = regex.CacheSnapshotList
+
+// GetCacheStats returns the hit, miss and eviction counters of the compiled regex cache, and the compRE preprocessing cache
+func GetCacheStats() CacheStats {
+	return regex.GetCacheStats()
+}
+
+// ResetCacheStats sets the hit and miss counters back to 0
+func ResetCacheStats() {
+	regex.ResetCacheStats()
+}
+
+// CacheSnapshot returns a list of the keys in the compiled regex cache, and the compRE preprocessing cache,
+// with their last use time and estimated size
+func CacheSnapshot() CacheSnapshotList {
+	return regex.CacheSnapshot()
+}
 
 //* regex methods
 
@@ -47,6 +216,13 @@ func (reg *Regexp) ReplaceFunc(str []byte, rep func(data func(int) []byte) []byt
 	return reg.reg.RepFunc(str, rep, blank...)
 }
 
+// ReplaceFuncNamed is the same as ReplaceFunc, but also gives the callback access to named capture groups
+//
+// named capture groups are written as (?<name>re), (?'name're) or (?P<name>re)
+func (reg *Regexp) ReplaceFuncNamed(str []byte, rep func(data func(int) []byte, named func(string) []byte) []byte, blank ...bool) []byte {
+	return reg.reg.RepFuncNamed(str, rep, blank...)
+}
+
 // ReplaceStringLiteral replaces a string with another string
 //
 // @rep uses the literal string, and does Not use args like $1
@@ -61,6 +237,8 @@ func (reg *Regexp) ReplaceStringLiteral(str []byte, rep []byte) []byte {
 // use $0 to use the full regex capture group
 //
 // use ${123} to use numbers with more than one digit
+//
+// use ${name} to use a named capture group
 func (reg *Regexp) ReplaceString(str []byte, rep []byte) []byte {
 	return reg.reg.RepStr(str, rep)
 }
@@ -77,6 +255,225 @@ func (reg *Regexp) Split(str []byte) [][]byte {
 	return reg.reg.Split(str)
 }
 
+// SubexpNames returns the names of the capture groups in the regex
+//
+// index 0 is the full match, and unnamed capture groups have an empty name
+func (reg *Regexp) SubexpNames() []string {
+	return reg.reg.SubexpNames()
+}
+
+// SubexpIndex returns the index of the first capture group with a given name, or -1 if there is no group with that name
+func (reg *Regexp) SubexpIndex(name string) int {
+	return reg.reg.SubexpIndex(name)
+}
+
+
+//* context methods
+
+// TimeoutError is returned when a context is canceled, or its deadline is exceeded, before a regex finished running
+type TimeoutError = regex.TimeoutError
+
+// MatchContext is the same as Match, but it returns a *TimeoutError if @ctx is done before a match is found
+func (reg *Regexp) MatchContext(ctx context.Context, str []byte) (bool, error) {
+	return reg.reg.MatchContext(ctx, str)
+}
+
+// ReplaceFuncContext is the same as ReplaceFunc, but it returns a *TimeoutError if @ctx is done before it finishes
+//
+// on error, the original []byte is returned unchanged
+func (reg *Regexp) ReplaceFuncContext(ctx context.Context, str []byte, rep func(data func(int) []byte) []byte, blank ...bool) ([]byte, error) {
+	return reg.reg.RepFuncContext(ctx, str, rep, blank...)
+}
+
+// ReplaceStringContext is the same as ReplaceString, but it returns a *TimeoutError if @ctx is done before it finishes
+//
+// on error, the original []byte is returned unchanged
+func (reg *Regexp) ReplaceStringContext(ctx context.Context, str []byte, rep []byte) ([]byte, error) {
+	return reg.reg.RepStrContext(ctx, str, rep)
+}
+
+// SplitContext is the same as Split, but it returns a *TimeoutError if @ctx is done before it finishes
+func (reg *Regexp) SplitContext(ctx context.Context, str []byte) ([][]byte, error) {
+	return reg.reg.SplitContext(ctx, str)
+}
+
+// FindAllContext is the same as FindAll, but it returns a *TimeoutError if @ctx is done before it finishes
+func (reg *Regexp) FindAllContext(ctx context.Context, str []byte, n int) ([][]byte, error) {
+	return reg.reg.FindAllContext(ctx, str, n)
+}
+
+// FindAllSubmatchContext is the same as FindAllSubmatch, but it returns a *TimeoutError if @ctx is done before it finishes
+func (reg *Regexp) FindAllSubmatchContext(ctx context.Context, str []byte, n int) ([][][]byte, error) {
+	return reg.reg.FindAllSubmatchContext(ctx, str, n)
+}
+
+//* stream methods
+
+// ReplaceWriter is an io.WriteCloser that replaces regex matches in everything written to it,
+// and writes the result to another io.Writer
+type ReplaceWriter = regex.RepWriter
+
+// NewReplaceWriter returns a ReplaceWriter that replaces matches with a string, in the same way as ReplaceString
+//
+// @maxReSize: the max length of a match in bytes (default: 10 times the length of the regex, with a min of 1024).
+// if set to 0 or less, there is no limit, and the input is buffered until a match can be finished
+func (reg *Regexp) NewReplaceWriter(w io.Writer, rep []byte, maxReSize ...int64) *ReplaceWriter {
+	return reg.reg.NewRepWriter(w, rep, maxReSize...)
+}
+
+// NewReplaceWriterFunc returns a ReplaceWriter that replaces matches with the result of a function, in the same way as ReplaceFunc
+//
+// @maxReSize: the max length of a match in bytes (see NewReplaceWriter)
+func (reg *Regexp) NewReplaceWriterFunc(w io.Writer, rep func(data func(int) []byte) []byte, maxReSize ...int64) *ReplaceWriter {
+	return reg.reg.NewRepWriterFunc(w, rep, maxReSize...)
+}
+
+// ReplaceReader copies an io.Reader to an io.Writer, and replaces matches with a string, in the same way as ReplaceString
+//
+// @maxReSize: the max length of a match in bytes (see NewReplaceWriter)
+func (reg *Regexp) ReplaceReader(r io.Reader, w io.Writer, rep []byte, maxReSize ...int64) error {
+	return reg.reg.RepReader(r, w, rep, maxReSize...)
+}
+
+// ReplaceReaderFunc copies an io.Reader to an io.Writer, and replaces matches with the result of a function, in the same way as ReplaceFunc
+//
+// @maxReSize: the max length of a match in bytes (see NewReplaceWriter)
+func (reg *Regexp) ReplaceReaderFunc(r io.Reader, w io.Writer, rep func(data func(int) []byte) []byte, maxReSize ...int64) error {
+	return reg.reg.RepReaderFunc(r, w, rep, maxReSize...)
+}
+
+//* regex find methods
+
+// FindIndex returns the start and end index of the first match, or nil if there is no match
+func (reg *Regexp) FindIndex(str []byte) []int {
+	return reg.reg.FindIndex(str)
+}
+
+// Find returns the first match of the regex, or nil if there is no match
+func (reg *Regexp) Find(str []byte) []byte {
+	return reg.reg.Find(str)
+}
+
+// FindSubmatchIndex returns the index pairs of the first match and its capture groups, or nil if there is no match
+//
+// a capture group that did not participate in the match has the indexes -1, -1
+func (reg *Regexp) FindSubmatchIndex(str []byte) []int {
+	return reg.reg.FindSubmatchIndex(str)
+}
+
+// FindSubmatch returns the first match and its capture groups, or nil if there is no match
+//
+// index 0 is the full match, and index 1 is the first capture group
+func (reg *Regexp) FindSubmatch(str []byte) [][]byte {
+	return reg.reg.FindSubmatch(str)
+}
+
+// FindAllIndex returns the start and end index of every match
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllIndex(str []byte, n int) [][]int {
+	return reg.reg.FindAllIndex(str, n)
+}
+
+// FindAll returns every match of the regex
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAll(str []byte, n int) [][]byte {
+	return reg.reg.FindAll(str, n)
+}
+
+// FindAllSubmatchIndex returns the index pairs of every match and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllSubmatchIndex(str []byte, n int) [][]int {
+	return reg.reg.FindAllSubmatchIndex(str, n)
+}
+
+// FindAllSubmatch returns every match of the regex and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllSubmatch(str []byte, n int) [][][]byte {
+	return reg.reg.FindAllSubmatch(str, n)
+}
+
+
+//* string methods
+
+// MatchString returns true if a string matches a regex
+func (reg *Regexp) MatchString(str string) bool {
+	return reg.reg.MatchString(str)
+}
+
+// ReplaceStringString is the same as ReplaceString, but for a string
+func (reg *Regexp) ReplaceStringString(str string, rep string) string {
+	return reg.reg.RepStrString(str, rep)
+}
+
+// ReplaceStringLiteralString is the same as ReplaceStringLiteral, but for a string
+func (reg *Regexp) ReplaceStringLiteralString(str string, rep string) string {
+	return reg.reg.RepStrLitString(str, rep)
+}
+
+// ReplaceFuncString is the same as ReplaceFunc, but for a string
+//
+// the loop cannot be stopped early
+func (reg *Regexp) ReplaceFuncString(str string, rep func(data func(int) string) string) string {
+	return reg.reg.RepFuncString(str, rep)
+}
+
+// SplitString splits a string, and keeps capture groups
+func (reg *Regexp) SplitString(str string) []string {
+	return reg.reg.SplitString(str)
+}
+
+// FindStringIndex returns the start and end index of the first match, or nil if there is no match
+func (reg *Regexp) FindStringIndex(str string) []int {
+	return reg.reg.FindStringIndex(str)
+}
+
+// FindString returns the first match of the regex, or an empty string if there is no match
+func (reg *Regexp) FindString(str string) string {
+	return reg.reg.FindString(str)
+}
+
+// FindStringSubmatchIndex returns the index pairs of the first match and its capture groups, or nil if there is no match
+func (reg *Regexp) FindStringSubmatchIndex(str string) []int {
+	return reg.reg.FindStringSubmatchIndex(str)
+}
+
+// FindStringSubmatch returns the first match and its capture groups, or nil if there is no match
+func (reg *Regexp) FindStringSubmatch(str string) []string {
+	return reg.reg.FindStringSubmatch(str)
+}
+
+// FindAllStringIndex returns the start and end index of every match
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllStringIndex(str string, n int) [][]int {
+	return reg.reg.FindAllStringIndex(str, n)
+}
+
+// FindAllString returns every match of the regex
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllString(str string, n int) []string {
+	return reg.reg.FindAllString(str, n)
+}
+
+// FindAllStringSubmatchIndex returns the index pairs of every match and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllStringSubmatchIndex(str string, n int) [][]int {
+	return reg.reg.FindAllStringSubmatchIndex(str, n)
+}
+
+// FindAllStringSubmatch returns every match of the regex and its capture groups
+//
+// @n: the max number of matches to return (if n < 0, all matches will be returned)
+func (reg *Regexp) FindAllStringSubmatch(str string, n int) [][]string {
+	return reg.reg.FindAllStringSubmatch(str, n)
+}
+
 
 //* other regex methods
 
@@ -85,6 +482,11 @@ func Escape(re string) string {
 	return regex.Escape(re)
 }
 
+// ParamList joins a list of values into a single param, for use with the %{1:list} modifier
+func ParamList(list ...string) string {
+	return regex.ParamList(list...)
+}
+
 // IsValid will return true if a regex is valid and can compile
 func IsValid(str []byte) bool {
 	if _, err := regexp.Compile(string(str)); err == nil {
@@ -101,378 +503,48 @@ func JoinBytes(bytes ...interface{}) []byte {
 
 // ReplaceFileString replaces a regex match with a new []byte in a file
 //
+// the result is written to a temporary file, which replaces the original file once it is complete,
+// so the original file is left unchanged if anything fails part way through.
+// an error is returned if the file is not writable, and the owner of the file is only kept if the process is allowed to change it
+//
 // @all: if true, will replace all text matching @re,
 // if false, will only replace the first occurrence
+//
+// @maxReSize: the max length of a match in bytes (default: no limit)
 func (reg *Regexp) ReplaceFileString(name string, rep []byte, all bool, maxReSize ...int64) error {
-	stat, err := os.Stat(name)
-	if err != nil || stat.IsDir() {
-		return err
-	}
-
-	file, err := os.OpenFile(name, os.O_RDWR, stat.Mode().Perm())
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	var found bool
-
-	l := int64(reg.len * 10)
-	if l < 1024 {
-		l = 1024
-	}
-	for _, maxRe := range maxReSize {
-		if l < maxRe {
-			l = maxRe
-		}
-	}
-
-	i := int64(0)
-
-	buf := make([]byte, l)
-	size, err := file.ReadAt(buf, i)
-	buf = buf[:size]
-	for err == nil {
-		if reg.Match(buf) {
-			found = true
-
-			repRes := reg.ReplaceString(buf, rep)
-
-			rl := int64(len(repRes))
-			if rl == l {
-				file.WriteAt(repRes, i)
-				file.Sync()
-			}else if rl < l {
-				file.WriteAt(repRes, i)
-				rl = l - rl
-
-				j := i+l
-
-				b := make([]byte, 1024)
-				s, e := file.ReadAt(b, j)
-				b = b[:s]
-
-				for e == nil {
-					file.WriteAt(b, j-rl)
-					j += 1024
-					b = make([]byte, 1024)
-					s, e = file.ReadAt(b, j)
-					b = b[:s]
-				}
-
-				if s != 0 {
-					file.WriteAt(b, j-rl)
-					j += int64(s)
-				}
-
-				file.Truncate(j-rl)
-				file.Sync()
-			}else if rl > l {
-				rl -= l
-
-				dif := int64(1024)
-				if rl > dif {
-					dif = rl
-				}
-
-				j := i+l
-
-				b := make([]byte, dif)
-				s, e := file.ReadAt(b, j)
-				bw := b[:s]
-
-				file.WriteAt(repRes, i)
-				j += rl
-
-				for e == nil {
-					b = make([]byte, dif)
-					s, e = file.ReadAt(b, j+dif-rl)
-				
-					file.WriteAt(bw, j)
-					bw = b[:s]
-
-					j += dif
-				}
-
-				file.WriteAt(bw, j)
-				file.Sync()
-			}
-
-			if !all {
-				file.Sync()
-				file.Close()
-				return nil
-			}
-
-			i += int64(len(repRes))
-		}
-
-		i++
-		buf = make([]byte, l)
-		size, err = file.ReadAt(buf, i)
-		buf = buf[:size]
-	}
-
-	if reg.Match(buf) {
-		found = true
-
-		repRes := reg.ReplaceString(buf, rep)
-
-		rl := int64(len(repRes))
-		if rl == l {
-			file.WriteAt(repRes, i)
-			file.Sync()
-		}else if rl < l {
-			file.WriteAt(repRes, i)
-			rl = l - rl
-
-			j := i+l
-
-			b := make([]byte, 1024)
-			s, e := file.ReadAt(b, j)
-			b = b[:s]
-
-			for e == nil {
-				file.WriteAt(b, j-rl)
-				j += 1024
-				b = make([]byte, 1024)
-				s, e = file.ReadAt(b, j)
-				b = b[:s]
-			}
-
-			if s != 0 {
-				file.WriteAt(b, j-rl)
-				j += int64(s)
-			}
-
-			file.Truncate(j-rl)
-			file.Sync()
-		}else if rl > l {
-			rl -= l
-
-			dif := int64(1024)
-			if rl > dif {
-				dif = rl
-			}
-
-			j := i+l
-
-			b := make([]byte, dif)
-			s, e := file.ReadAt(b, j)
-			bw := b[:s]
-
-			file.WriteAt(repRes, i)
-			j += rl
-
-			for e == nil {
-				b = make([]byte, dif)
-				s, e = file.ReadAt(b, j+dif-rl)
-			
-				file.WriteAt(bw, j)
-				bw = b[:s]
-
-				j += dif
-			}
-
-			file.WriteAt(bw, j)
-			file.Sync()
-		}
-	}
-
-	file.Sync()
-	file.Close()
-
-	if !found {
-		return io.EOF
-	}
-	return nil
+	return reg.reg.RepFileStr(name, rep, all, maxReSize...)
 }
 
 // ReplaceFileFunc replaces a regex match with the result of a callback function in a file
 //
+// the result is written to a temporary file, which replaces the original file once it is complete,
+// so the original file is left unchanged if anything fails part way through.
+// an error is returned if the file is not writable, and the owner of the file is only kept if the process is allowed to change it
+//
 // @all: if true, will replace all text matching @re,
 // if false, will only replace the first occurrence
+//
+// @maxReSize: the max length of a match in bytes (default: no limit)
 func (reg *Regexp) ReplaceFileFunc(name string, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) error {
-	stat, err := os.Stat(name)
-	if err != nil || stat.IsDir() {
-		return err
-	}
-
-	file, err := os.OpenFile(name, os.O_RDWR, stat.Mode().Perm())
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	var found bool
-
-	l := int64(reg.len * 10)
-	if l < 1024 {
-		l = 1024
-	}
-	for _, maxRe := range maxReSize {
-		if l < maxRe {
-			l = maxRe
-		}
-	}
+	return reg.reg.RepFileFunc(name, rep, all, maxReSize...)
+}
 
-	i := int64(0)
-
-	buf := make([]byte, l)
-	size, err := file.ReadAt(buf, i)
-	buf = buf[:size]
-	for err == nil {
-		if reg.Match(buf) {
-			found = true
-
-			repRes := reg.ReplaceFunc(buf, rep)
-
-			rl := int64(len(repRes))
-			if rl == l {
-				file.WriteAt(repRes, i)
-				file.Sync()
-			}else if rl < l {
-				file.WriteAt(repRes, i)
-				rl = l - rl
-
-				j := i+l
-
-				b := make([]byte, 1024)
-				s, e := file.ReadAt(b, j)
-				b = b[:s]
-
-				for e == nil {
-					file.WriteAt(b, j-rl)
-					j += 1024
-					b = make([]byte, 1024)
-					s, e = file.ReadAt(b, j)
-					b = b[:s]
-				}
-
-				if s != 0 {
-					file.WriteAt(b, j-rl)
-					j += int64(s)
-				}
-
-				file.Truncate(j-rl)
-				file.Sync()
-			}else if rl > l {
-				rl -= l
-
-				dif := int64(1024)
-				if rl > dif {
-					dif = rl
-				}
-
-				j := i+l
-
-				b := make([]byte, dif)
-				s, e := file.ReadAt(b, j)
-				bw := b[:s]
-
-				file.WriteAt(repRes, i)
-				j += rl
-
-				for e == nil {
-					b = make([]byte, dif)
-					s, e = file.ReadAt(b, j+dif-rl)
-				
-					file.WriteAt(bw, j)
-					bw = b[:s]
-
-					j += dif
-				}
-
-				file.WriteAt(bw, j)
-				file.Sync()
-			}
-
-			if !all {
-				file.Sync()
-				file.Close()
-				return nil
-			}
-
-			i += int64(len(repRes))
-		}
-
-		i++
-		buf = make([]byte, l)
-		size, err = file.ReadAt(buf, i)
-		buf = buf[:size]
-	}
+// TreeOptions are the options used by ReplaceTreeString and ReplaceTreeFunc
+type TreeOptions = regex.TreeOptions
 
-	if reg.Match(buf) {
-		found = true
-
-		repRes := reg.ReplaceFunc(buf, rep)
-
-		rl := int64(len(repRes))
-		if rl == l {
-			file.WriteAt(repRes, i)
-			file.Sync()
-		}else if rl < l {
-			file.WriteAt(repRes, i)
-			rl = l - rl
-
-			j := i+l
-
-			b := make([]byte, 1024)
-			s, e := file.ReadAt(b, j)
-			b = b[:s]
-
-			for e == nil {
-				file.WriteAt(b, j-rl)
-				j += 1024
-				b = make([]byte, 1024)
-				s, e = file.ReadAt(b, j)
-				b = b[:s]
-			}
-
-			if s != 0 {
-				file.WriteAt(b, j-rl)
-				j += int64(s)
-			}
-
-			file.Truncate(j-rl)
-			file.Sync()
-		}else if rl > l {
-			rl -= l
-
-			dif := int64(1024)
-			if rl > dif {
-				dif = rl
-			}
-
-			j := i+l
-
-			b := make([]byte, dif)
-			s, e := file.ReadAt(b, j)
-			bw := b[:s]
-
-			file.WriteAt(repRes, i)
-			j += rl
-
-			for e == nil {
-				b = make([]byte, dif)
-				s, e = file.ReadAt(b, j+dif-rl)
-			
-				file.WriteAt(bw, j)
-				bw = b[:s]
-
-				j += dif
-			}
-
-			file.WriteAt(bw, j)
-			file.Sync()
-		}
-	}
+// TreeChange is a summary of the changes made to a single file by ReplaceTreeString or ReplaceTreeFunc
+type TreeChange = regex.TreeChange
 
-	file.Sync()
-	file.Close()
+// ReplaceTreeString replaces a regex match with a new []byte in every file in a directory tree
+//
+// use the DryRun option to get a unified diff of each change, without modifying any files
+func (reg *Regexp) ReplaceTreeString(root string, rep []byte, opts TreeOptions) ([]TreeChange, error) {
+	return reg.reg.RepTreeStr(root, rep, opts)
+}
 
-	if !found {
-		return io.EOF
-	}
-	return nil
+// ReplaceTreeFunc replaces a regex match with the result of a callback function in every file in a directory tree
+//
+// use the DryRun option to get a unified diff of each change, without modifying any files
+func (reg *Regexp) ReplaceTreeFunc(root string, rep func(data func(int) []byte) []byte, opts TreeOptions) ([]TreeChange, error) {
+	return reg.reg.RepTreeFunc(root, rep, opts)
 }